@@ -1,130 +1,252 @@
 package reglib
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"net/url"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
 )
 
+var repoPathRegexp = regexp.MustCompile(`^/v2/(.+)/(tags|manifests|blobs)/`)
+
 type author struct {
-	userInfo   *url.Userinfo
-	client     *http.Client
-	tokens     map[string]token
+	creds     Credentials
+	client    *http.Client
+	tokens    *tokenCache
+	userAgent string
+	logger    Logger
+	metrics   MetricsCollector
+	tracer    Tracer
+
 	tokenMutex sync.RWMutex
+	// account|realm|service -> refresh token, guarded by tokenMutex
+	refreshTokens map[string]string
+
+	// the credentials and the challenges of the hosts, the credentials are
+	// refreshed when the registry says 401, and the challenges are used to
+	// authorize the requests before the registry asks for it
+	auths      map[string]AuthConfig
+	challenges map[string]Challenge
+	authMutex  sync.RWMutex
 }
 
-func newAuthRoundTripper(u, p string) *author {
+func newAuthRoundTripper(creds Credentials, tr http.RoundTripper,
+	timeout time.Duration, userAgent string, logger Logger) *author {
+
+	tokens := newTokenCache()
+	tokens.logger = logger
 	return &author{
-		userInfo: url.UserPassword(u, p),
+		creds: creds,
 		client: &http.Client{
-			Transport: &http.Transport{
-				MaxConnsPerHost:     50,
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 50,
-			},
-			Timeout: 10 * time.Second,
+			Transport: tr,
+			Timeout:   timeout,
 		},
-		tokens: make(map[string]token, 100),
+		userAgent:     userAgent,
+		logger:        logger,
+		metrics:       nopMetrics{},
+		tracer:        nopTracer{},
+		tokens:        tokens,
+		refreshTokens: make(map[string]string),
+		auths:         make(map[string]AuthConfig),
+		challenges:    make(map[string]Challenge),
 	}
 }
 
 func (a *author) RoundTrip(req *http.Request) (*http.Response, error) {
-	req.URL.User = a.userInfo
+	ctx := req.Context()
+	host := req.URL.Host
+	auth, err := a.credential(ctx, host, false)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(ctx)
+	a.setUserAgent(req)
+	if auth.Username != "" || auth.Password != "" {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+	bearer := a.preauthorize(req, auth)
 	resp, err := a.client.Do(req)
 	if err != nil {
-		if err == errHTTPS {
-			req.URL.Scheme = "http"
-			resp, err = a.client.Do(req)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, err
-		}
+		return nil, err
 	}
 
-	if resp.StatusCode == http.StatusUnauthorized {
-		authString, err := a.getAuthString(resp)
-		if err != nil {
-			return resp, err
-		}
-		req.Header.Set("Authorization", authString)
-		return a.client.Do(req)
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	c, err := preferredChallenge(resp)
+	if err != nil {
+		// nothing to answer, let the caller handle the 401
+		a.logger.Debug("no challenge to answer", "host", host,
+			"method", req.Method, "url", req.URL.String(), "error", err)
+		return resp, nil
 	}
+	resp.Body.Close()
 
-	return resp, nil
+	// the credential may have been rotated, ask the provider again
+	auth, err = a.credential(ctx, host, true)
+	if err != nil {
+		return nil, err
+	}
+	authString, err := a.getAuthString(ctx, host, c, auth, bearer)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", authString)
+	return a.client.Do(req)
 }
 
-func (a *author) getAuthString(resp *http.Response) (string, error) {
-	challenge := resp.Header.Get("WWW-Authenticate")
+func (a *author) setUserAgent(req *http.Request) {
+	if a.userAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", a.userAgent)
+	}
+}
 
-	if t := a.checkToken(challenge); t != "" {
-		return t, nil
+// preauthorize sets the bearer token of the request if the host is known
+// to use the token auth, so the request won't be rejected with 401 first,
+// returns the token it set
+func (a *author) preauthorize(req *http.Request, auth AuthConfig) string {
+	a.authMutex.RLock()
+	c, exist := a.challenges[req.URL.Host]
+	a.authMutex.RUnlock()
+	if !exist || c.Scheme != "bearer" {
+		return ""
+	}
+	scopes := requestScopes(req)
+	if scopes == nil {
+		return ""
 	}
 
-	s := strings.Split(challenge, " ")
-	authType, details := s[0], s[1]
-	m := string2Map(details)
+	key := tokenCacheKey(auth, c.Realm(), c.Service(), scopes)
+	bearer, err := a.tokens.get(req.Context(), key,
+		a.tokenFetcher(req.URL.Host, c.Realm(), c.Service(), scopes))
+	if err != nil {
+		a.logger.Debug("preauthorize error", "host", req.URL.Host,
+			"url", req.URL.String(), "error", err)
+		return ""
+	}
+	req.Header.Set("Authorization", "Bearer "+bearer)
+	return bearer
+}
 
-	if m["realm"] == registryRealm {
-		// we have already set the userinfo, just return an empty
-		// auth token and the client will add the auth header by default
-		return "", nil
+// requestScopes predicts the scopes of the request by its path and method
+func requestScopes(req *http.Request) []string {
+	if req.URL.Path == "/v2/_catalog" {
+		return []string{"registry:catalog:*"}
+	}
+	m := repoPathRegexp.FindStringSubmatch(req.URL.Path)
+	if m == nil {
+		return nil
 	}
+	action := "pull"
+	switch req.Method {
+	case "GET", "HEAD":
+	case "DELETE":
+		action = "delete"
+	default:
+		action = "pull,push"
+	}
+	return []string{"repository:" + m[1] + ":" + action}
+}
 
-	req, err := http.NewRequest("GET", m["realm"], nil)
-	q := req.URL.Query()
-	q.Set("service", m["service"])
-	q.Set("scope", m["scope"])
-	req.URL.RawQuery = q.Encode()
-	req.URL.User = a.userInfo
+// credential returns the credential of the host, it asks the provider
+// only when the host is new or refresh is set
+func (a *author) credential(ctx context.Context, host string, refresh bool) (AuthConfig, error) {
+	if !refresh {
+		a.authMutex.RLock()
+		auth, exist := a.auths[host]
+		a.authMutex.RUnlock()
+		if exist {
+			return auth, nil
+		}
+	}
 
-	authResp, err := a.client.Do(req)
+	auth, err := a.creds.Credential(ctx, host)
 	if err != nil {
-		return "", err
+		return auth, fmt.Errorf("get credential of %s error: %s", host, err)
 	}
-	defer authResp.Body.Close()
+	a.authMutex.Lock()
+	a.auths[host] = auth
+	a.authMutex.Unlock()
+	return auth, nil
+}
 
-	tokenBytes, err := ioutil.ReadAll(authResp.Body)
-	if err != nil {
-		return "", err
+// getAuthString answers the challenge of the host, the rejected
+// bearer token is dropped from the cache
+func (a *author) getAuthString(ctx context.Context, host string,
+	c Challenge, auth AuthConfig, rejected string) (string, error) {
+
+	a.authMutex.Lock()
+	a.challenges[host] = c
+	a.authMutex.Unlock()
+
+	if c.Scheme == "basic" {
+		return "Basic " + auth.auth(), nil
 	}
-	t := token{}
-	if err := json.Unmarshal(tokenBytes, &t); err != nil {
-		return "", err
+
+	scopes := c.Scopes()
+	key := tokenCacheKey(auth, c.Realm(), c.Service(), scopes)
+	if rejected != "" {
+		a.tokens.invalidate(key, rejected)
 	}
-	if t.Error != "" {
-		fmt.Printf("auth error: %s\n", t.Error)
+	bearer, err := a.tokens.get(ctx, key, a.tokenFetcher(host, c.Realm(), c.Service(), scopes))
+	if err != nil {
+		return "", err
 	}
-	// modify the issue_at time, since the data time of the registry may not
-	// the same as ours
-	t.IssuedAt = time.Now()
 
-	t.typ = authType
-	a.storeToken(challenge, t)
+	return "Bearer " + bearer, nil
+}
 
-	return fmt.Sprintf("%s %s", t.typ, t.Token), nil
+// scheme returns the auth scheme the host challenged, it's empty if
+// the host never asks for the auth
+func (a *author) scheme(host string) string {
+	a.authMutex.RLock()
+	defer a.authMutex.RUnlock()
+	return a.challenges[host].Scheme
 }
 
-func (a *author) checkToken(challenge string) string {
-	a.tokenMutex.RLock()
-	defer a.tokenMutex.RUnlock()
-	if t, exist := a.tokens[challenge]; exist {
-		exp := time.Second * time.Duration(t.ExpiresIn)
-		if t.IssuedAt.Sub(time.Now().Add(exp)).Seconds() > 0 {
-			return fmt.Sprintf("%s %s", t.typ, t.Token)
+// preferredChallenge returns the bearer challenge of the response if
+// there is one, otherwise the basic one
+func preferredChallenge(resp *http.Response) (Challenge, error) {
+	challenges, err := ResponseChallenges(resp)
+	if err != nil {
+		return Challenge{}, err
+	}
+	var basic *Challenge
+	for i, c := range challenges {
+		switch c.Scheme {
+		case "bearer":
+			if c.Realm() == "" {
+				return c, fmt.Errorf("bearer challenge without realm: %s", c)
+			}
+			return c, nil
+		case "basic":
+			basic = &challenges[i]
 		}
 	}
-	return ""
+	if basic != nil {
+		return *basic, nil
+	}
+	return Challenge{}, fmt.Errorf("unsupported challenges: %v", challenges)
 }
 
-func (a *author) storeToken(challenge string, t token) {
-	a.tokenMutex.Lock()
-	a.tokens[challenge] = t
-	a.tokenMutex.Unlock()
+// tokenFetcher returns the function to fetch the token of the registry host
+func (a *author) tokenFetcher(host, realm, service string, scopes []string) tokenFetcher {
+	return func(ctx context.Context) (t token, err error) {
+		ctx, span := a.tracer.Start(ctx, "reglib.Token")
+		span.SetAttributes("registry.host", host, "auth.realm", realm,
+			"auth.service", service, "auth.scopes", strings.Join(scopes, " "))
+		defer func() { endSpan(span, err) }()
+
+		auth, err := a.credential(ctx, host, false)
+		if err != nil {
+			return token{}, err
+		}
+		t, err = a.fetchToken(ctx, realm, service, scopes, auth)
+		a.metrics.TokenFetched(host, err)
+		return t, err
+	}
 }
@@ -0,0 +1,252 @@
+package reglib
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Challenge is an auth challenge of the WWW-Authenticate header,
+// see https://tools.ietf.org/html/rfc7235#section-2.1
+type Challenge struct {
+	// Scheme is the lower-cased auth scheme, e.g. "basic", "bearer"
+	Scheme string
+	// Parameters are the auth params, the names are lower-cased
+	Parameters map[string]string
+	// Token68 is set if the challenge carries a token68 instead of
+	// the auth params
+	Token68 string
+}
+
+// Realm returns the "realm" param
+func (c Challenge) Realm() string {
+	return c.Parameters["realm"]
+}
+
+// Service returns the "service" param of the bearer challenge
+func (c Challenge) Service() string {
+	return c.Parameters["service"]
+}
+
+// Scopes returns the space-delimited "scope" param of the bearer challenge
+func (c Challenge) Scopes() []string {
+	return strings.Fields(c.Parameters["scope"])
+}
+
+// String formats the challenge, the params are sorted by name
+func (c Challenge) String() string {
+	if c.Token68 != "" {
+		return c.Scheme + " " + c.Token68
+	}
+	names := make([]string, 0, len(c.Parameters))
+	for name := range c.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	params := make([]string, 0, len(names))
+	for _, name := range names {
+		v := strings.Replace(c.Parameters[name], `\`, `\\`, -1)
+		v = strings.Replace(v, `"`, `\"`, -1)
+		params = append(params, fmt.Sprintf(`%s="%s"`, name, v))
+	}
+	if len(params) == 0 {
+		return c.Scheme
+	}
+	return c.Scheme + " " + strings.Join(params, ",")
+}
+
+// ParseChallenges parses the challenges of the WWW-Authenticate header
+// value, a value may contain multiple challenges
+func ParseChallenges(value string) ([]Challenge, error) {
+	p := &challengeParser{s: value}
+	challenges := []Challenge{}
+	for {
+		p.skipListSeparators()
+		if p.eof() {
+			return challenges, nil
+		}
+		c, err := p.challenge()
+		if err != nil {
+			return challenges, err
+		}
+		challenges = append(challenges, c)
+	}
+}
+
+// ResponseChallenges parses all the WWW-Authenticate headers of the response
+func ResponseChallenges(resp *http.Response) ([]Challenge, error) {
+	challenges := []Challenge{}
+	for _, value := range resp.Header[http.CanonicalHeaderKey("WWW-Authenticate")] {
+		cs, err := ParseChallenges(value)
+		if err != nil {
+			return challenges, err
+		}
+		challenges = append(challenges, cs...)
+	}
+	return challenges, nil
+}
+
+type challengeParser struct {
+	s string
+	i int
+}
+
+func (p *challengeParser) eof() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *challengeParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.i]
+}
+
+func (p *challengeParser) errorf(format string, v ...interface{}) error {
+	return fmt.Errorf("bad challenge %q at %d: %s", p.s, p.i, fmt.Sprintf(format, v...))
+}
+
+// skipSpaces skips the OWS
+func (p *challengeParser) skipSpaces() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.i++
+	}
+}
+
+// skipListSeparators skips the OWS and the empty list elements
+func (p *challengeParser) skipListSeparators() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t' || p.peek() == ',') {
+		p.i++
+	}
+}
+
+// challenge = auth-scheme [ 1*SP ( token68 / #auth-param ) ]
+func (p *challengeParser) challenge() (Challenge, error) {
+	scheme := p.token()
+	if scheme == "" {
+		return Challenge{}, p.errorf("expect an auth scheme")
+	}
+	c := Challenge{
+		Scheme:     strings.ToLower(scheme),
+		Parameters: make(map[string]string),
+	}
+	if p.eof() || p.peek() == ',' {
+		return c, nil
+	}
+	if p.peek() != ' ' && p.peek() != '\t' {
+		return c, p.errorf("unexpected %q after the auth scheme", p.peek())
+	}
+	p.skipSpaces()
+	if t, ok := p.token68(); ok {
+		c.Token68 = t
+		return c, nil
+	}
+
+	for {
+		p.skipListSeparators()
+		if p.eof() {
+			return c, nil
+		}
+		start := p.i
+		name := p.token()
+		if name == "" {
+			return c, p.errorf("unexpected %q", p.peek())
+		}
+		p.skipSpaces()
+		if p.peek() != '=' {
+			// it's the scheme of the next challenge
+			p.i = start
+			return c, nil
+		}
+		p.i++
+		p.skipSpaces()
+		value, err := p.value()
+		if err != nil {
+			return c, err
+		}
+		c.Parameters[strings.ToLower(name)] = value
+		p.skipSpaces()
+		if !p.eof() && p.peek() != ',' {
+			return c, p.errorf("unexpected %q after the param %s", p.peek(), name)
+		}
+	}
+}
+
+// token68 = 1*( ALPHA / DIGIT / "-" / "." / "_" / "~" / "+" / "/" ) *"="
+// it must be the only thing of the challenge
+func (p *challengeParser) token68() (string, bool) {
+	start := p.i
+	for !p.eof() && isToken68Char(p.peek()) {
+		p.i++
+	}
+	if p.i == start {
+		return "", false
+	}
+	for !p.eof() && p.peek() == '=' {
+		p.i++
+	}
+	end := p.i
+	p.skipSpaces()
+	if p.eof() || p.peek() == ',' {
+		return p.s[start:end], true
+	}
+	p.i = start
+	return "", false
+}
+
+// value = token / quoted-string
+func (p *challengeParser) value() (string, error) {
+	if p.peek() != '"' {
+		v := p.token()
+		if v == "" {
+			return "", p.errorf("expect a token or a quoted string")
+		}
+		return v, nil
+	}
+
+	p.i++
+	var b strings.Builder
+	for !p.eof() {
+		ch := p.peek()
+		p.i++
+		switch ch {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if p.eof() {
+				return "", p.errorf("unterminated quoted string")
+			}
+			b.WriteByte(p.peek())
+			p.i++
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return "", p.errorf("unterminated quoted string")
+}
+
+func (p *challengeParser) token() string {
+	start := p.i
+	for !p.eof() && isTokenChar(p.peek()) {
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+// tchar, see https://tools.ietf.org/html/rfc7230#section-3.2.6
+func isTokenChar(ch byte) bool {
+	switch {
+	case 'a' <= ch && ch <= 'z', 'A' <= ch && ch <= 'Z', '0' <= ch && ch <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", ch) >= 0
+}
+
+func isToken68Char(ch byte) bool {
+	switch {
+	case 'a' <= ch && ch <= 'z', 'A' <= ch && ch <= 'Z', '0' <= ch && ch <= '9':
+		return true
+	}
+	return strings.IndexByte("-._~+/", ch) >= 0
+}
@@ -0,0 +1,121 @@
+package reglib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseChallenges(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []Challenge
+	}{
+		{
+			value: `Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:a:pull,push"`,
+			want: []Challenge{{Scheme: "bearer", Parameters: map[string]string{
+				"realm":   "https://auth.docker.io/token",
+				"service": "registry.docker.io",
+				"scope":   "repository:a:pull,push",
+			}}},
+		},
+		{
+			value: `Basic realm="Registry Realm"`,
+			want: []Challenge{{Scheme: "basic", Parameters: map[string]string{
+				"realm": "Registry Realm",
+			}}},
+		},
+		{
+			value: `Newauth realm="apps", type=1, title="Login to \"apps\"", Basic realm="simple"`,
+			want: []Challenge{
+				{Scheme: "newauth", Parameters: map[string]string{
+					"realm": "apps",
+					"type":  "1",
+					"title": `Login to "apps"`,
+				}},
+				{Scheme: "basic", Parameters: map[string]string{
+					"realm": "simple",
+				}},
+			},
+		},
+		{
+			value: `Negotiate abc+/==, Bearer  Realm = "r" ,, scope="a b"`,
+			want: []Challenge{
+				{Scheme: "negotiate", Parameters: map[string]string{}, Token68: "abc+/=="},
+				{Scheme: "bearer", Parameters: map[string]string{
+					"realm": "r",
+					"scope": "a b",
+				}},
+			},
+		},
+		{
+			value: `Bearer`,
+			want:  []Challenge{{Scheme: "bearer", Parameters: map[string]string{}}},
+		},
+		{
+			value: ``,
+			want:  []Challenge{},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseChallenges(tt.value)
+		if err != nil {
+			t.Errorf("parse %s error: %s", tt.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parse %s\n got %+v\nwant %+v", tt.value, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{
+		`Bearer realm="unterminated`,
+		`Bearer a="b", realm=`,
+		`Bearer realm="a" service="b"`,
+		`=realm`,
+		`Bearer;`,
+	} {
+		if _, err := ParseChallenges(bad); err == nil {
+			t.Errorf("expect an error of %s", bad)
+		}
+	}
+}
+
+func TestChallengeScopes(t *testing.T) {
+	cs, err := ParseChallenges(`Bearer realm="r",scope="repository:a:pull repository:b:pull,push"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"repository:a:pull", "repository:b:pull,push"}
+	if got := cs[0].Scopes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func FuzzParseChallenges(f *testing.F) {
+	for _, seed := range []string{
+		`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:a:pull,push"`,
+		`Basic realm="Registry Realm"`,
+		`Newauth realm="apps", type=1, title="Login to \"apps\"", Basic realm="simple"`,
+		`Negotiate abc+/==, Bearer realm="r"`,
+		`Bearer`,
+		` , `,
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		challenges, err := ParseChallenges(value)
+		if err != nil {
+			return
+		}
+		// the formatted challenges must be parsed to the same ones
+		for _, c := range challenges {
+			again, err := ParseChallenges(c.String())
+			if err != nil {
+				t.Fatalf("parse %q (from %q) error: %s", c.String(), value, err)
+			}
+			if len(again) != 1 || !reflect.DeepEqual(again[0], c) {
+				t.Fatalf("parse %q (from %q) got %+v, want %+v", c.String(), value, again, c)
+			}
+		}
+	})
+}
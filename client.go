@@ -2,13 +2,13 @@ package reglib
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	dis "github.com/docker/distribution"
 	"github.com/docker/distribution/reference"
@@ -20,174 +20,240 @@ type Client struct {
 	baseURL  string
 	username string
 	password string
-
-	registry    rClient.Registry
-	author      http.RoundTripper
+	creds    Credentials
+
+	// persist the bearer tokens to the file if set
+	tokenCacheFile string
+	// the base TLS config and the dir of the certificates of the hosts
+	tlsConfig *tls.Config
+	certsDir  string
+	// the mirrors of the registry to read from, in order
+	mirrors []string
+	// the proxies, they're read from the environment if nil
+	proxy *ProxyConfig
+	// the insecure registries, host[:port] or CIDR
+	insecureRegistries []string
+	baseTransport      http.RoundTripper
+	maxConnsPerHost    int
+	retryPolicy        RetryPolicy
+	// the requests per second and the burst of every host, and the
+	// requests in flight of all the hosts
+	rateLimit      float64
+	rateBurst      int
+	maxConcurrency int
+	// the middlewares and the hooks of the requests
+	middlewares   []Middleware
+	requestHooks  []RequestHook
+	responseHooks []ResponseHook
+
+	timeout     time.Duration
+	loadTimeout time.Duration
+	userAgent   string
+	pageSize    int
+	logger      Logger
+	metrics     MetricsCollector
+	tracer      Tracer
+
+	author      *author
+	transport   http.RoundTripper
 	registryURL *url.URL
 	client      *http.Client
+
+	// the capabilities discovered by Ping and the downloads
+	caps      *Capabilities
+	capsMutex sync.RWMutex
 }
 
 func (c *Client) init() error {
-	u, err := url.Parse(c.baseURL)
-	if err != nil {
-		return err
-	}
-	if u.Scheme == "" {
+	// "host:port" is not parsed as a URL without a scheme
+	if !strings.Contains(c.baseURL, "://") {
 		c.baseURL = "https://" + c.baseURL
 	}
+	c.baseURL = strings.TrimSuffix(c.baseURL, "/")
 
-	c.registryURL, _ = url.Parse(c.baseURL)
+	var err error
+	c.registryURL, err = url.Parse(c.baseURL)
+	if err != nil {
+		return err
+	}
 
-	c.author = newAuthRoundTripper(c.username, c.password)
-	c.registry, err = rClient.NewRegistry(c.baseURL, c.author)
+	if c.creds == nil {
+		c.creds = StaticCredentials(c.username, c.password)
+	}
+	if c.pageSize <= 0 {
+		c.pageSize = defaultPageSize
+	}
+	if c.loadTimeout <= 0 {
+		c.loadTimeout = defaultLoadTimeout
+	}
+	if c.logger == nil {
+		c.logger = nopLogger{}
+	}
+	if c.metrics == nil {
+		c.metrics = nopMetrics{}
+	}
+	if c.tracer == nil {
+		c.tracer = nopTracer{}
+	}
 
+	tr := c.baseTransport
+	if tr == nil {
+		insecure, err := newInsecureRegistries(c.insecureRegistries)
+		if err != nil {
+			return err
+		}
+		insecure.logger = c.logger
+		proxyConfig := ProxyFromEnvironment()
+		if c.proxy != nil {
+			proxyConfig = *c.proxy
+		}
+		proxy, err := proxyConfig.proxyFunc()
+		if err != nil {
+			return err
+		}
+		tr = newTransport(c.tlsConfig, c.certsDir, insecure,
+			c.maxConnsPerHost, proxy, c.logger)
+	}
+	tr = &metricsTransport{next: tr, metrics: c.metrics}
+	tr = &tracingTransport{next: tr, tracer: c.tracer}
+	tr = newLimitTransport(tr, c.rateLimit, c.rateBurst, c.maxConcurrency)
+	tr = newRetryTransport(tr, c.retryPolicy, c.logger)
+	tr = chainMiddlewares(tr, c.middlewares, c.requestHooks, c.responseHooks)
+	author := newAuthRoundTripper(c.creds, tr, c.timeout, c.userAgent, c.logger)
+	author.metrics = c.metrics
+	author.tracer = c.tracer
+	author.tokens.metrics = c.metrics
+	if c.tokenCacheFile != "" {
+		if err := author.tokens.persist(c.tokenCacheFile); err != nil {
+			c.logger.Warn("load token cache error",
+				"file", c.tokenCacheFile, "error", err)
+		}
+	}
+	c.author = author
+	c.transport, err = newMirrorTransport(author, c.registryURL.Host, c.mirrors, c.logger)
+	if err != nil {
+		return err
+	}
 	c.client = &http.Client{
-		Transport: c.author,
+		Transport: c.transport,
 	}
 
-	return err
+	return nil
+}
+
+// contextTransport sends the requests with the ctx, since the
+// distribution client doesn't pass the contexts to the requests
+type contextTransport struct {
+	ctx  context.Context
+	next http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.next.RoundTrip(req.WithContext(t.ctx))
+}
+
+// withContext returns the transport of the distribution client which
+// sends the requests with the ctx
+func (c *Client) withContext(ctx context.Context) http.RoundTripper {
+	return contextTransport{ctx: ctx, next: c.transport}
+}
+
+// tls returns the TLS config to be modified by the options
+func (c *Client) tls() *tls.Config {
+	if c.tlsConfig == nil {
+		c.tlsConfig = &tls.Config{}
+	}
+	return c.tlsConfig
 }
 
 func (c *Client) Repos(ctx context.Context,
 	opts *ListRepoOptions) ([]Repository, error) {
 
-	repoChan, err := c.ReposChan(ctx, opts)
+	it, err := c.IterRepos(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
+	defer it.Close()
 	repos := []Repository{}
-	for repo := range repoChan {
-		repos = append(repos, repo)
+	for it.Next(ctx) {
+		repos = append(repos, it.Value())
 	}
-	return repos, nil
+	return repos, it.Err()
 }
 
+// ReposChan returns the channel of the repos, it's closed when the
+// listing is done, failed or the ctx is canceled, use IterRepos to get
+// the error of the listing
 func (c *Client) ReposChan(ctx context.Context,
 	opts *ListRepoOptions) (chan Repository, error) {
 
-	if opts == nil {
-		opts = &ListRepoOptions{}
-	} else {
-		// check opts
-		if opts.Start > opts.End {
-			return nil, fmt.Errorf("invalid start(%d) and end(%d)", opts.Start, opts.End)
-		}
+	it, err := c.IterRepos(ctx, opts)
+	if err != nil {
+		return nil, err
 	}
-
-	var (
-		last        = ""
-		size, total = 50, 0
-		start, end  = opts.Start, opts.End
-		allRepos    = make(chan string, size)
-		repoChan    = make(chan Repository)
-	)
-
+	repoChan := make(chan Repository)
 	go func() {
-		defer close(allRepos)
-		for {
-			tempRepos := make([]string, size)
-			n, err := c.registry.Repositories(ctx, tempRepos, last)
-			slice2Chan(tempRepos[:n], allRepos)
-			if err == io.EOF {
-				break
-			}
-			if err == nil {
-				total += n
-				if end != 0 && total > end {
-					break
-				}
-				last = tempRepos[n-1]
-				continue
-			} else {
-				log.Printf("get repos error: %s\n", err)
+		defer close(repoChan)
+		defer it.Close()
+		for it.Next(ctx) {
+			select {
+			case repoChan <- it.Value():
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
-
-	go func() {
-		var wg sync.WaitGroup
-		var i int
-		for name := range allRepos {
-			if i < start || (i >= end && end > 0) {
-				continue
-			}
-			wg.Add(1)
-			go func(repo string) {
-				defer wg.Done()
-				var tags []Tag
-				var err error
-
-				if opts.WithTags {
-					tags, err = c.Tags(ctx, repo, nil)
-				}
-
-				repoChan <- Repository{
-					Namespace: strings.Split(repo, "/")[0],
-					Name:      repo,
-					tags:      tags,
-					cli:       c,
-					tagErr:    err,
-				}
-			}(name)
-			i++
-		}
-		wg.Wait()
-		// runtime.Goexit()
-		close(repoChan)
-	}()
-
 	return repoChan, nil
 }
 
+// Tags lists the tags of the repository, the repo can be an image
+// reference, its tag and digest are ignored
 func (c *Client) Tags(ctx context.Context, repo string,
 	opts *ListTagOptions) ([]Tag, error) {
 
-	if opts == nil {
-		opts = &ListTagOptions{}
-	}
-
-	named, err := reference.WithName(repo)
+	it, err := c.IterTags(ctx, repo, opts)
 	if err != nil {
 		return nil, err
 	}
-
-	r, err := rClient.NewRepository(named, c.baseURL, c.author)
-	if err != nil {
-		return nil, err
+	defer it.Close()
+	tags := []Tag{}
+	for it.Next(ctx) {
+		tags = append(tags, it.Value())
 	}
-
-	tags, err := r.Tags(ctx).All(ctx)
-	if err != nil {
+	if err := it.Err(); err != nil {
 		return nil, err
 	}
-
-	manifestTags := make([]Tag, 0, len(tags))
-	var img *Image
-	for _, tag := range tags {
-		if opts.WithManifest {
-			img, err = c.Image(ctx, repo, tag)
-		}
-		manifestTags = append(manifestTags, Tag{
-			FullName: repo + ":" + tag,
-			Name:     tag,
-			RepoName: repo,
-			image:    img,
-			cli:      c,
-			imgErr:   err,
-		})
-	}
-
-	return manifestTags, nil
-
+	return tags, nil
 }
 
+// Image gets the image by the repo and the tag, the repo can be an image
+// reference like "alpine:3.19" or "alpine@sha256:...", the tag overrides
+// the one of the reference, and it's latest if neither is given. The
+// image of a digest is got without the tag, a tag along with the digest
+// is an error, and the schemav1 manifest is not fetched for it
 func (c *Client) Image(ctx context.Context, repo, tag string) (img *Image, err error) {
 	img = &Image{c: c}
 
-	if tag == "" {
-		tag = "latest"
+	ref, err := c.reference(repo)
+	if err != nil {
+		return img, err
+	}
+	if tag != "" {
+		ref.Tag = tag
 	}
-	r, err := c.newRepo(repo, tag)
+	if ref.Tag != "" && ref.Digest != "" {
+		return img, fmt.Errorf("image %s error: both the tag %s and the digest are given",
+			ref.Name(), ref.Tag)
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	img.ref = ref
+
+	ctx, span := c.startSpan(ctx, "reglib.Image", "repo", ref.Repository,
+		"tag", ref.Tag, "digest", ref.Digest)
+	defer func() { endSpan(span, err) }()
+	r, err := c.newRepo(ctx, ref.Repository)
 	if err != nil {
 		return img, err
 	}
@@ -197,31 +263,39 @@ func (c *Client) Image(ctx context.Context, repo, tag string) (img *Image, err e
 		return img, err
 	}
 
-	img.V1, err = manifestV1(ctx, ms, tag)
-	if err != nil {
-		return img, fmt.Errorf("get schamev1 error: %s", err)
+	if ref.Tag != "" {
+		img.V1, err = manifestV1(ctx, ms, ref.Tag)
+		if err != nil {
+			return img, fmt.Errorf("get schamev1 error: %w", registryError(err))
+		}
 	}
 
-	img.V2, err = manifestV2(ctx, ms, tag)
+	img.V2, err = manifestV2(ctx, ms, ref.Tag, ref.Digest)
 	if err != nil {
-		return img, fmt.Errorf("get schamev2 error: %s", err)
+		return img, fmt.Errorf("get schamev2 error: %w", registryError(err))
 	}
 
 	return img, err
 }
 
+// Download gets the image of the reference and downloads it to the
+// target, see Image.Download
+func (c *Client) Download(ctx context.Context, ref, target string) error {
+	img, err := c.Image(ctx, ref, "")
+	if err != nil {
+		return err
+	}
+	return img.Download(ctx, target)
+}
+
 func (c *Client) Host() string {
 	return c.registryURL.Host
 }
 
-func (c *Client) newRepo(name, tag string) (dis.Repository, error) {
+func (c *Client) newRepo(ctx context.Context, name string) (dis.Repository, error) {
 	named, err := reference.WithName(name)
 	if err != nil {
 		return nil, err
 	}
-	nt, err := reference.WithTag(named, tag)
-	if err != nil {
-		return nil, err
-	}
-	return rClient.NewRepository(nt, c.baseURL, c.author)
+	return rClient.NewRepository(named, c.baseURL, c.withContext(ctx))
 }
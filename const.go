@@ -1,7 +1,15 @@
 package reglib
 
+import "time"
+
 const (
-	registryRealm = "Registry Realm"
+	defaultTimeout         = 10 * time.Second
+	defaultLoadTimeout     = 5 * time.Second
+	defaultUserAgent       = "reglib"
+	defaultPageSize        = 50
+	defaultMaxConnsPerHost = 50
+	defaultMaxConcurrency  = 50
+	defaultTagWorkers      = 8
 
 	bSize  ImageSize = 1
 	kbSize           = bSize << 10
@@ -0,0 +1,70 @@
+package reglib
+
+import (
+	"context"
+	"os"
+)
+
+// Credentials provides the credential of a registry host, the client
+// consults it every time it (re)authenticates against the host, so the
+// implementations can rotate the secrets without rebuilding the client
+type Credentials interface {
+	// Credential returns the credential of the host, an empty
+	// AuthConfig means anonymous
+	Credential(ctx context.Context, host string) (AuthConfig, error)
+}
+
+// CredentialsFunc is an adapter to use a function as the Credentials
+type CredentialsFunc func(ctx context.Context, host string) (AuthConfig, error)
+
+// Credential calls f(ctx, host)
+func (f CredentialsFunc) Credential(ctx context.Context, host string) (AuthConfig, error) {
+	return f(ctx, host)
+}
+
+// StaticCredentials returns the same username and password for every host
+func StaticCredentials(username, password string) Credentials {
+	return CredentialsFunc(func(context.Context, string) (AuthConfig, error) {
+		return AuthConfig{Username: username, Password: password}, nil
+	})
+}
+
+// DockerConfigCredentials reads the credential from the docker config
+// file ($HOME/.docker/config.json) and its credential helpers, the file
+// is read on every call
+func DockerConfigCredentials() Credentials {
+	return CredentialsFunc(func(_ context.Context, host string) (AuthConfig, error) {
+		return GetAuthConfig(host)
+	})
+}
+
+// EnvCredentials reads the username and password from the environment
+// variables, e.g. EnvCredentials("REGISTRY_USER", "REGISTRY_PASS")
+func EnvCredentials(userEnv, passEnv string) Credentials {
+	return CredentialsFunc(func(context.Context, string) (AuthConfig, error) {
+		return AuthConfig{
+			Username: os.Getenv(userEnv),
+			Password: os.Getenv(passEnv),
+		}, nil
+	})
+}
+
+// ChainCredentials asks the providers in order and returns the first
+// non-empty credential, the errors are returned only if all the
+// providers failed to give one
+func ChainCredentials(providers ...Credentials) Credentials {
+	return CredentialsFunc(func(ctx context.Context, host string) (AuthConfig, error) {
+		var lastErr error
+		for _, p := range providers {
+			auth, err := p.Credential(ctx, host)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if !auth.empty() {
+				return auth, nil
+			}
+		}
+		return AuthConfig{}, lastErr
+	})
+}
@@ -0,0 +1,86 @@
+package reglib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestChainCredentials(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TEST_REG_USER", "env-user")
+	t.Setenv("TEST_REG_PASS", "env-pass")
+
+	failed := CredentialsFunc(func(context.Context, string) (AuthConfig, error) {
+		return AuthConfig{}, errors.New("failed")
+	})
+	auth, err := ChainCredentials(
+		failed,
+		StaticCredentials("", ""),
+		EnvCredentials("TEST_REG_USER", "TEST_REG_PASS"),
+		StaticCredentials("static", "static"),
+	).Credential(ctx, "r.kfd.me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.Username != "env-user" || auth.Password != "env-pass" {
+		t.Errorf("got %+v", auth)
+	}
+
+	if _, err := ChainCredentials(failed).Credential(ctx, "r.kfd.me"); err == nil {
+		t.Error("expect an error")
+	}
+}
+
+func TestRotateCredentials(t *testing.T) {
+	var (
+		m        sync.Mutex
+		password = "old"
+		asked    = map[string]int{}
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		if u, p, ok := r.BasicAuth(); !ok || u != "admin" || p != password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Registry Realm"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"repositories":["alpine"]}`))
+	}))
+	defer ts.Close()
+
+	creds := CredentialsFunc(func(_ context.Context, host string) (AuthConfig, error) {
+		m.Lock()
+		defer m.Unlock()
+		asked[host]++
+		return AuthConfig{Username: "admin", Password: password}, nil
+	})
+	r, err := NewWithCredentials(ts.URL, creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, p := range []string{"old", "old", "new"} {
+		m.Lock()
+		password = p
+		m.Unlock()
+		repos, err := r.Repos(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(repos) != 1 {
+			t.Errorf("got repos %v with password %s", repos, p)
+		}
+	}
+
+	// once for the new host, once for the rotation
+	if n := asked[r.Host()]; n != 2 {
+		t.Errorf("the credential is asked %d times", n)
+	}
+}
@@ -0,0 +1,81 @@
+package reglib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	credHelperPrefix = "docker-credential-"
+	// the username returned by the helpers when the secret is an identity token
+	credHelperTokenUser = "<token>"
+	// the server address docker uses to store the credential of docker hub
+	dockerHubServer = "https://index.docker.io/v1/"
+)
+
+// credHelperCredential is the payload of `docker-credential-<name> get`
+type credHelperCredential struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// credHelper talks to the docker-credential-<name> binaries,
+// see https://github.com/docker/docker-credential-helpers
+type credHelper string
+
+func (h credHelper) run(action, input string) ([]byte, error) {
+	cmd := exec.Command(credHelperPrefix+string(h), action)
+	cmd.Stdin = strings.NewReader(input)
+	stdout := new(bytes.Buffer)
+	cmd.Stdout = stdout
+	if err := cmd.Run(); err != nil {
+		out := strings.TrimSpace(stdout.String())
+		if strings.Contains(out, "credentials not found") {
+			return nil, errCredNotFound
+		}
+		if out == "" {
+			return nil, fmt.Errorf("%s%s %s: %s", credHelperPrefix, h, action, err)
+		}
+		return nil, fmt.Errorf("%s%s %s: %s", credHelperPrefix, h, action, out)
+	}
+	return stdout.Bytes(), nil
+}
+
+// get the credential of the server
+func (h credHelper) get(server string) (AuthConfig, error) {
+	bs, err := h.run("get", server)
+	if err != nil {
+		return AuthConfig{}, err
+	}
+	c := credHelperCredential{}
+	if err := json.Unmarshal(bs, &c); err != nil {
+		return AuthConfig{}, fmt.Errorf("bad output of %s%s: %s", credHelperPrefix, h, err)
+	}
+	if c.Username == credHelperTokenUser {
+		return AuthConfig{IdentityToken: c.Secret}, nil
+	}
+	return AuthConfig{Username: c.Username, Password: c.Secret}, nil
+}
+
+// list the servers stored in the helper, server -> username
+func (h credHelper) list() (map[string]string, error) {
+	bs, err := h.run("list", "")
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string)
+	return m, json.Unmarshal(bs, &m)
+}
+
+// helperServer returns the server address that docker uses as the key
+// of the host in the credential helpers
+func helperServer(host string) string {
+	if isDockerHub(host) {
+		return dockerHubServer
+	}
+	return host
+}
@@ -0,0 +1,119 @@
+package reglib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// a fake docker-credential-<name> which knows the credential of
+// "helper.io" and the docker hub
+const fakeCredHelper = `#!/bin/sh
+read server
+case "$1" in
+get)
+	case "$server" in
+	helper.io)
+		echo '{"ServerURL":"helper.io","Username":"helper-user","Secret":"helper-pass"}' ;;
+	https://index.docker.io/v1/)
+		echo '{"ServerURL":"https://index.docker.io/v1/","Username":"<token>","Secret":"identity"}' ;;
+	*)
+		echo "credentials not found in native keychain"; exit 1 ;;
+	esac ;;
+list)
+	echo '{"helper.io":"helper-user","https://index.docker.io/v1/":"<token>"}' ;;
+esac
+`
+
+func setupDockerConfig(t *testing.T, config string) {
+	home, bin := t.TempDir(), t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, ".docker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := ioutil.WriteFile(filepath.Join(home, dockerConfigPath), []byte(config), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(bin, credHelperPrefix+"fake"), []byte(fakeCredHelper), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", home)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestCredHelpers(t *testing.T) {
+	// "inline.io" is admin:admin123
+	setupDockerConfig(t, `{
+		"auths": {
+			"https://inline.io": {"auth": "YWRtaW46YWRtaW4xMjM="},
+			"helper.io": {"auth": "YWRtaW46YWRtaW4xMjM="}
+		},
+		"credHelpers": {"helper.io": "fake", "inline.io": "fake"}
+	}`)
+
+	t.Run("credHelpers", func(t *testing.T) {
+		u, p := GetAuthFromFile("https://helper.io")
+		if u != "helper-user" || p != "helper-pass" {
+			t.Errorf("got %s:%s", u, p)
+		}
+	})
+
+	t.Run("fallback to auths", func(t *testing.T) {
+		u, p := GetAuthFromFile("inline.io")
+		if u != "admin" || p != "admin123" {
+			t.Errorf("got %s:%s", u, p)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		u, p := GetAuthFromFile("unknown.io")
+		if u != "" || p != "" {
+			t.Errorf("got %s:%s", u, p)
+		}
+	})
+}
+
+func TestCredsStore(t *testing.T) {
+	setupDockerConfig(t, `{
+		"auths": {"inline.io": {"auth": "YWRtaW46YWRtaW4xMjM="}},
+		"credsStore": "fake"
+	}`)
+
+	auth, err := GetAuthConfig("registry-1.docker.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.IdentityToken != "identity" {
+		t.Errorf("got %+v", auth)
+	}
+
+	tokens, err := GetAuthTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 {
+		t.Errorf("got %v", tokens)
+	}
+	if u, p := UnmarshalAuth(tokens["helper.io"]); u != "helper-user" || p != "helper-pass" {
+		t.Errorf("got %s:%s", u, p)
+	}
+	if u, p := UnmarshalAuth(tokens["inline.io"]); u != "admin" || p != "admin123" {
+		t.Errorf("got %s:%s", u, p)
+	}
+}
+
+func TestCredHelperMissing(t *testing.T) {
+	setupDockerConfig(t, `{
+		"auths": {"inline.io": {"auth": "YWRtaW46YWRtaW4xMjM="}},
+		"credsStore": "missing"
+	}`)
+
+	if u, p := GetAuthFromFile("inline.io"); u != "admin" || p != "admin123" {
+		t.Errorf("got %s:%s", u, p)
+	}
+	if _, err := GetAuthConfig("other.io"); err == nil {
+		t.Error("expect an error when the helper is missing")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -34,46 +35,111 @@ func splitRanges(length int) []string {
 	return append(x, makeupRange(length-final, length))
 }
 
-func (c *Client) parallelDownload(ctx context.Context, path, target string, length int) error {
+// downloadBlob gets the length of the blob and downloads it in parallel
+func (c *Client) downloadBlob(ctx context.Context, repo, digest, target string) error {
+	start := time.Now()
+	path := fmt.Sprintf("/v2/%s/blobs/%s", repo, digest)
+	req, err := http.NewRequestWithContext(ctx, "HEAD",
+		fmt.Sprintf("%s%s", c.baseURL, path), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return newRegistryError(resp)
+	}
+
+	length, err := strconv.Atoi(resp.Header.Get("Content-Length"))
+	if err != nil {
+		return fmt.Errorf("bad content length: %s", err)
+	}
+	if s := rangeSupport(resp.Header); s != SupportUnknown {
+		c.setRangeSupport(s)
+	}
+	caps, _ := c.capabilities()
+	ranged := caps.RangeRequests != Unsupported
+
+	err = c.parallelDownload(ctx, path, target, length, ranged)
+	if err == errRangeIgnored {
+		c.setRangeSupport(Unsupported)
+		err = c.parallelDownload(ctx, path, target, length, false)
+	}
+	if err != nil {
+		return err
+	}
+	c.logger.Debug("blob downloaded", "host", c.Host(), "repo", repo,
+		"digest", digest, "size", length, "duration", time.Since(start))
+	return nil
+}
+
+// parallelDownload downloads the blob in ranges in parallel, or in one
+// request if the ranges are not supported
+func (c *Client) parallelDownload(ctx context.Context, path, target string,
+	length int, ranged bool) error {
 
 	wg := new(sync.WaitGroup)
-	errChan := make(chan error, 5)
-	contentRanges := splitRanges(length)
+	contentRanges := []string{""}
+	if ranged {
+		contentRanges = splitRanges(length)
+	}
+	errChan := make(chan error, len(contentRanges))
 
-	downloadStart := time.Now()
 	for part, contentRange := range contentRanges {
 		wg.Add(1)
 		go func(part int, contentRange string) {
 			defer wg.Done()
 
-			req, err := http.NewRequest("GET",
+			req, err := http.NewRequestWithContext(ctx, "GET",
 				fmt.Sprintf("%s%s", c.baseURL, path), nil)
 			if err != nil {
 				errChan <- err
 				return
 			}
-			req.Header.Set("Range", contentRange)
+			if contentRange != "" {
+				req.Header.Set("Range", contentRange)
+			}
 			resp, err := c.client.Do(req)
 			if err != nil {
 				errChan <- err
 				return
 			}
 			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK &&
+				resp.StatusCode != http.StatusPartialContent {
+				errChan <- newRegistryError(resp)
+				return
+			}
+			// the whole blob is responded to every range
+			if resp.StatusCode == http.StatusOK && len(contentRanges) > 1 {
+				errChan <- errRangeIgnored
+				return
+			}
 			f, err := os.Create(fmt.Sprintf("%s.part%d", target, part))
 			if err != nil {
 				errChan <- err
 				return
 			}
 			defer f.Close()
-			if _, err := io.Copy(f, resp.Body); err != nil {
+			n, err := io.Copy(f, resp.Body)
+			c.metrics.BytesDownloaded(c.Host(), n)
+			if err != nil {
 				errChan <- err
 			}
 		}(part, contentRange)
 	}
 	wg.Wait()
-	debug("download %s use %s", target, time.Now().Sub(downloadStart))
+	close(errChan)
+	if err := <-errChan; err != nil {
+		for part := range contentRanges {
+			os.Remove(fmt.Sprintf("%s.part%d", target, part))
+		}
+		return err
+	}
 
-	start := time.Now()
 	for part := len(contentRanges) - 1; part > 0; part-- {
 		if part == 0 {
 			break
@@ -102,7 +168,6 @@ func (c *Client) parallelDownload(ctx context.Context, path, target string, leng
 			return err
 		}
 	}
-	debug("merge %s use %s", target, time.Now().Sub(start))
 
 	return os.Rename(fmt.Sprintf("%s.part0", target), target)
 }
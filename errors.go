@@ -1,8 +1,181 @@
 package reglib
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/docker/distribution/registry/api/errcode"
+	rClient "github.com/docker/distribution/registry/client"
+)
+
+var (
+	// ErrNotFound means the repository, manifest or blob is unknown
+	ErrNotFound = errors.New("not found")
+	// ErrUnauthorized means the credential is required or invalid
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrDenied means the access to the resource is denied
+	ErrDenied = errors.New("denied")
+	// ErrTooManyRequests means the client is throttled by the registry
+	ErrTooManyRequests = errors.New("too many requests")
+	// ErrUnsupported means the operation is not supported by the registry
+	ErrUnsupported = errors.New("unsupported")
+)
 
 var (
-	errHTTPS  = errors.New("http: server gave HTTP response to HTTPS client")
 	errNilCli = errors.New("client is nil")
+
+	errCredNotFound = errors.New("credentials not found")
+
+	errTokenGETUnsupported = errors.New("token server does not support GET")
+
+	errRangeIgnored = errors.New("registry ignores the range requests")
 )
+
+// ErrorDetail is an error of the registry's error envelope, see
+// https://docs.docker.com/registry/spec/api/#errors
+type ErrorDetail struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message,omitempty"`
+	Detail  interface{} `json:"detail,omitempty"`
+}
+
+// RegistryError is the error responded by the registry (or its token
+// server), use errors.Is with ErrNotFound, ErrUnauthorized, ErrDenied,
+// ErrTooManyRequests and ErrUnsupported to check the kind of it
+type RegistryError struct {
+	// StatusCode is the HTTP status code, it's inferred from the error
+	// codes if the status is unknown
+	StatusCode int
+	Errors     []ErrorDetail
+}
+
+func (e *RegistryError) Error() string {
+	status := fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if len(e.Errors) == 0 {
+		return "registry error: " + status
+	}
+	msgs := make([]string, 0, len(e.Errors))
+	for _, detail := range e.Errors {
+		msg := detail.Code
+		if detail.Message != "" {
+			msg += ": " + detail.Message
+		}
+		if detail.Detail != nil {
+			msg += fmt.Sprintf(" (%v)", detail.Detail)
+		}
+		msgs = append(msgs, msg)
+	}
+	return fmt.Sprintf("registry error: %s: %s", status, strings.Join(msgs, "; "))
+}
+
+// Is reports whether the error is one of the exported sentinel errors
+func (e *RegistryError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound ||
+			e.hasCode("NAME_UNKNOWN", "MANIFEST_UNKNOWN", "BLOB_UNKNOWN", "NOT_FOUND")
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.hasCode("UNAUTHORIZED")
+	case ErrDenied:
+		return e.StatusCode == http.StatusForbidden || e.hasCode("DENIED")
+	case ErrTooManyRequests:
+		return e.StatusCode == http.StatusTooManyRequests || e.hasCode("TOOMANYREQUESTS")
+	case ErrUnsupported:
+		return e.StatusCode == http.StatusMethodNotAllowed || e.hasCode("UNSUPPORTED")
+	}
+	return false
+}
+
+func (e *RegistryError) hasCode(codes ...string) bool {
+	for _, detail := range e.Errors {
+		for _, code := range codes {
+			if detail.Code == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newRegistryError reads the error envelope from the failed response
+func newRegistryError(resp *http.Response) error {
+	e := &RegistryError{StatusCode: resp.StatusCode}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil || len(body) == 0 {
+		return e
+	}
+
+	envelope := struct {
+		Errors []ErrorDetail `json:"errors"`
+		// the token servers may respond {"details": "..."}
+		Details string `json:"details"`
+	}{}
+	if json.Unmarshal(body, &envelope) != nil {
+		e.Errors = []ErrorDetail{{Code: "UNKNOWN", Detail: strings.TrimSpace(string(body))}}
+		return e
+	}
+	e.Errors = envelope.Errors
+	if len(e.Errors) == 0 && envelope.Details != "" {
+		e.Errors = []ErrorDetail{{Code: "UNKNOWN", Message: envelope.Details}}
+	}
+	return e
+}
+
+// registryError converts the errors of the distribution client to
+// *RegistryError, other errors are returned as is
+func registryError(err error) error {
+	switch e := err.(type) {
+	case errcode.Errors:
+		re := &RegistryError{}
+		for _, x := range e {
+			detail, status, ok := errcodeDetail(x)
+			if !ok {
+				return err
+			}
+			if re.StatusCode == 0 {
+				re.StatusCode = status
+			}
+			re.Errors = append(re.Errors, detail)
+		}
+		return re
+	case errcode.Error, errcode.ErrorCode:
+		detail, status, _ := errcodeDetail(e)
+		return &RegistryError{StatusCode: status, Errors: []ErrorDetail{detail}}
+	case *rClient.UnexpectedHTTPResponseError:
+		return &RegistryError{StatusCode: e.StatusCode, Errors: []ErrorDetail{{
+			Code:   "UNKNOWN",
+			Detail: strings.TrimSpace(string(e.Response)),
+		}}}
+	case *rClient.UnexpectedHTTPStatusError:
+		// the status is like "404 Not Found"
+		code, convErr := strconv.Atoi(strings.SplitN(e.Status, " ", 2)[0])
+		if convErr != nil {
+			return err
+		}
+		return &RegistryError{StatusCode: code}
+	}
+	return err
+}
+
+func errcodeDetail(err error) (ErrorDetail, int, bool) {
+	switch e := err.(type) {
+	case errcode.Error:
+		return ErrorDetail{
+			Code:    e.Code.String(),
+			Message: e.Message,
+			Detail:  e.Detail,
+		}, e.Code.Descriptor().HTTPStatusCode, true
+	case errcode.ErrorCode:
+		return ErrorDetail{
+			Code:    e.String(),
+			Message: e.Message(),
+		}, e.Descriptor().HTTPStatusCode, true
+	}
+	return ErrorDetail{}, 0, false
+}
@@ -0,0 +1,121 @@
+package reglib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+)
+
+func writeRegistryError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(`{"errors":[{"code":"` + code + `","message":"` + message + `","detail":{"name":"x"}}]}`))
+}
+
+func TestRegistryErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/_catalog":
+			writeRegistryError(w, http.StatusTooManyRequests, "TOOMANYREQUESTS", "slow down")
+		case strings.HasPrefix(r.URL.Path, "/v2/denied/"):
+			writeRegistryError(w, http.StatusForbidden, "DENIED", "requested access to the resource is denied")
+		case strings.Contains(r.URL.Path, "/tags/"):
+			writeRegistryError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+		case strings.Contains(r.URL.Path, "/manifests/"):
+			writeRegistryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	r, err := New(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	t.Run("repos", func(t *testing.T) {
+		_, err := r.Repos(ctx, nil)
+		if !errors.Is(err, ErrTooManyRequests) {
+			t.Errorf("got %v", err)
+		}
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		_, err := r.Tags(ctx, "alpine", nil)
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("got %v", err)
+		}
+		var re *RegistryError
+		if !errors.As(err, &re) || len(re.Errors) != 1 || re.Errors[0].Code != "NAME_UNKNOWN" {
+			t.Errorf("got %+v", re)
+		}
+	})
+
+	t.Run("image", func(t *testing.T) {
+		_, err := r.Image(ctx, "alpine", "latest")
+		if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrDenied) {
+			t.Errorf("got %v", err)
+		}
+		_, err = r.Image(ctx, "denied/alpine", "latest")
+		if !errors.Is(err, ErrDenied) {
+			t.Errorf("got %v", err)
+		}
+	})
+
+	t.Run("download", func(t *testing.T) {
+		err := r.(*Client).downloadBlob(ctx, "alpine", "sha256:abc", t.TempDir()+"/blob")
+		var re *RegistryError
+		if !errors.As(err, &re) || re.StatusCode != http.StatusNotFound || !errors.Is(err, ErrNotFound) {
+			t.Errorf("got %v", err)
+		}
+	})
+}
+
+func TestUnauthorizedError(t *testing.T) {
+	registry, tokenServer := newTokenRegistry(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"details":"incorrect username or password"}`))
+	})
+	defer registry.Close()
+	defer tokenServer.Close()
+
+	r, err := NewWithAuth(registry.URL, "admin", "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Repos(context.Background(), nil)
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("got %v", err)
+	}
+	if !strings.Contains(err.Error(), "incorrect username or password") {
+		t.Errorf("got %s", err)
+	}
+}
+
+func TestConvertRegistryError(t *testing.T) {
+	err := registryError(errcode.Errors{
+		v2.ErrorCodeManifestUnknown.WithMessage("manifest unknown"),
+		errcode.ErrorCodeDenied,
+	})
+	var re *RegistryError
+	if !errors.As(err, &re) {
+		t.Fatalf("got %T", err)
+	}
+	if re.StatusCode != http.StatusNotFound || len(re.Errors) != 2 ||
+		!errors.Is(err, ErrNotFound) || !errors.Is(err, ErrDenied) {
+		t.Errorf("got %+v", re)
+	}
+
+	other := errors.New("other")
+	if registryError(other) != other {
+		t.Error("the other errors should be returned as is")
+	}
+}
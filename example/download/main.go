@@ -1,3 +1,6 @@
+//go:build go1.21
+// +build go1.21
+
 package main
 
 import (
@@ -5,6 +8,8 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"os"
 	"strings"
 
 	"github.com/wrfly/reglib"
@@ -17,32 +22,28 @@ func main() {
 	target := flag.String("t", "alpine:latest", "target image")
 	flag.Parse()
 
-	targetTag := "latest"
-	x := strings.Split(*target, ":")
-	targetRepo := x[0]
-	if len(x) == 2 {
-		targetTag = x[1]
+	ref, err := reglib.ParseReference(*target)
+	if err != nil {
+		panic(err)
 	}
 
 	log.Printf("connect to registry [%s] with [%s:%s]\n",
 		*registry, *user, *pass)
 
-	r, err := reglib.New(*registry, *user, *pass)
-	if err != nil {
-		panic(err)
-	}
-	reglib.DEBUG = true
-
-	image, err := r.Image(context.Background(), targetRepo, targetTag)
+	logger := slog.New(slog.NewTextHandler(os.Stderr,
+		&slog.HandlerOptions{Level: slog.LevelDebug}))
+	r, err := reglib.New(*registry,
+		reglib.WithBasicAuth(*user, *pass),
+		reglib.WithLogger(reglib.SlogLogger(logger)),
+	)
 	if err != nil {
 		panic(err)
 	}
 
-	err = image.Download(context.Background(),
-		fmt.Sprintf("/tmp/reglib/%s", strings.Replace(targetRepo, "/", ".", -1)),
+	err = r.Download(context.Background(), *target,
+		fmt.Sprintf("/tmp/reglib/%s", strings.Replace(ref.Repository, "/", ".", -1)),
 	)
 	if err != nil {
 		panic(err)
 	}
-
 }
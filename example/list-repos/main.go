@@ -18,20 +18,22 @@ func main() {
 	log.Printf("connect to registry [%s] with [%s:%s]\n",
 		*registry, *user, *pass)
 
-	r, err := reglib.New(*registry, *user, *pass)
+	r, err := reglib.New(*registry, reglib.WithBasicAuth(*user, *pass))
 	if err != nil {
 		panic(err)
 	}
 
-	repos, err := r.ReposChan(context.Background(), &reglib.ListRepoOptions{
+	ctx := context.Background()
+	it, err := r.IterRepos(ctx, &reglib.ListRepoOptions{
 		WithTags: true,
 	})
 	if err != nil {
-		return
+		log.Fatalf("list repos error: %s", err)
 	}
-	log.Printf("get repos info chan...\n")
+	defer it.Close()
 
-	for repo := range repos {
+	for it.Next(ctx) {
+		repo := it.Value()
 		tags, err := repo.Tags()
 		if err != nil {
 			log.Printf("get [%s] tags error: %s\n", repo.Name, err)
@@ -43,5 +45,7 @@ func main() {
 			fmt.Printf("%s %v\n", repo.Name, reglib.ExtractTagNames(tags))
 		}
 	}
-
+	if err := it.Err(); err != nil {
+		log.Fatalf("list repos error: %s", err)
+	}
 }
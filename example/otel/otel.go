@@ -0,0 +1,79 @@
+//go:build otel
+// +build otel
+
+// Package otel adapts the OpenTelemetry tracer to the reglib.Tracer, it's
+// not built by default to keep OpenTelemetry out of the dependencies of
+// reglib, copy it or build with `-tags otel` after adding
+// go.opentelemetry.io/otel to your go.mod
+package otel
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wrfly/reglib"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer returns the reglib.Tracer starting the spans by t
+func Tracer(t trace.Tracer) reglib.Tracer {
+	return tracer{t}
+}
+
+type tracer struct {
+	t trace.Tracer
+}
+
+func (t tracer) Start(ctx context.Context, name string) (context.Context, reglib.Span) {
+	ctx, s := t.t.Start(ctx, name)
+	return ctx, span{s}
+}
+
+type span struct {
+	s trace.Span
+}
+
+func (s span) SetAttributes(keysAndValues ...interface{}) {
+	s.s.SetAttributes(attributes(keysAndValues)...)
+}
+
+func (s span) AddEvent(name string, keysAndValues ...interface{}) {
+	s.s.AddEvent(name, trace.WithAttributes(attributes(keysAndValues)...))
+}
+
+func (s span) RecordError(err error) {
+	s.s.RecordError(err)
+	s.s.SetStatus(codes.Error, err.Error())
+}
+
+func (s span) End() {
+	s.s.End()
+}
+
+func attributes(keysAndValues []interface{}) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(keysAndValues)/2)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		switch v := keysAndValues[i+1].(type) {
+		case nil:
+		case string:
+			attrs = append(attrs, attribute.String(key, v))
+		case bool:
+			attrs = append(attrs, attribute.Bool(key, v))
+		case int:
+			attrs = append(attrs, attribute.Int(key, v))
+		case int64:
+			attrs = append(attrs, attribute.Int64(key, v))
+		case float64:
+			attrs = append(attrs, attribute.Float64(key, v))
+		case time.Duration:
+			attrs = append(attrs, attribute.Int64(key+"_ms", v.Milliseconds()))
+		default:
+			attrs = append(attrs, attribute.String(key, fmt.Sprint(v)))
+		}
+	}
+	return attrs
+}
@@ -22,7 +22,7 @@ func main() {
 	log.Printf("connect to registry [%s] with [%s:%s] and dumps to dir [%s]\n",
 		*registry, *user, *pass, *dir)
 
-	r, err := reglib.New(*registry, *user, *pass)
+	r, err := reglib.New(*registry, reglib.WithBasicAuth(*user, *pass))
 	if err != nil {
 		panic(err)
 	}
@@ -6,7 +6,6 @@ import (
 	"log"
 	"os"
 	"os/signal"
-	"strings"
 	"time"
 
 	"github.com/wrfly/reglib"
@@ -26,23 +25,21 @@ func main() {
 	log.Printf("connect to registry [%s] with [%s:%s]",
 		*registry, *user, *pass)
 
-	r, err := reglib.New(*registry, *user, *pass)
+	r, err := reglib.New(*registry, reglib.WithBasicAuth(*user, *pass))
 	if err != nil {
 		panic(err)
 	}
-	if !strings.Contains(*image, ":") {
-		panic("bad image")
+	if _, err := reglib.ParseReference(*image); err != nil {
+		panic(err)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	// watch changes
 	go func() {
-		repo := strings.Split(*image, ":")[0]
-		tag := strings.Split(*image, ":")[1]
 		var created time.Time
-		log.Printf("watch [%s:%s] changes", repo, tag)
+		log.Printf("watch [%s] changes", *image)
 		for ctx.Err() == nil {
-			img, err := r.Image(context.Background(), repo, tag)
+			img, err := r.Image(context.Background(), *image, "")
 			if err != nil {
 				panic(err)
 			}
@@ -59,7 +56,7 @@ func main() {
 		}
 	}()
 
-	sigC := make(chan os.Signal)
+	sigC := make(chan os.Signal, 1)
 	signal.Notify(sigC, os.Interrupt)
 
 	<-sigC
@@ -0,0 +1,133 @@
+package reglib
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// validate checks the options
+func (o *ListRepoOptions) validate() error {
+	if o.Start < 0 || o.End < 0 || (o.End > 0 && o.Start > o.End) {
+		return fmt.Errorf("invalid start(%d) and end(%d)", o.Start, o.End)
+	}
+	if o.Workers < 0 {
+		return fmt.Errorf("invalid workers(%d)", o.Workers)
+	}
+	if o.Glob != "" {
+		if _, err := path.Match(o.Glob, ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %s", o.Glob, err)
+		}
+	}
+	return nil
+}
+
+// namespacePrefix returns the prefix of the repositories in the namespace
+func (o *ListRepoOptions) namespacePrefix() string {
+	ns := strings.Trim(o.Namespace, "/")
+	if ns == "" {
+		return ""
+	}
+	return ns + "/"
+}
+
+// match reports whether the repository matches the options
+func (o *ListRepoOptions) match(repo string) bool {
+	if !strings.HasPrefix(repo, o.namespacePrefix()) ||
+		!strings.HasPrefix(repo, o.Prefix) {
+		return false
+	}
+	if o.Glob != "" {
+		if ok, _ := path.Match(o.Glob, repo); !ok {
+			return false
+		}
+	}
+	if o.Regexp != nil && !o.Regexp.MatchString(repo) {
+		return false
+	}
+	return true
+}
+
+// past reports whether the repositories after the repo in the sorted
+// catalog can't match the options, so the listing can stop early
+func (o *ListRepoOptions) past(repo string) bool {
+	for _, prefix := range []string{o.namespacePrefix(), o.Prefix, globPrefix(o.Glob)} {
+		if prefix != "" && catalogKey(repo) > catalogKey(prefix) &&
+			!strings.HasPrefix(repo, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// catalogKey returns the key of the repo in the order of the catalog, the
+// registry sorts the repositories by the path components, i.e. the "/"
+// is lower than any other character, e.g. "app/x" is before "app-web"
+func catalogKey(repo string) string {
+	return strings.ReplaceAll(repo, "/", "\x00")
+}
+
+// globPrefix returns the literal prefix of the glob pattern
+func globPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// validate checks the options
+func (o *ListTagOptions) validate() error {
+	if o.Limit < 0 {
+		return fmt.Errorf("invalid limit(%d)", o.Limit)
+	}
+	if o.Order < TagOrderDefault || o.Order > TagOrderCreated {
+		return fmt.Errorf("invalid order(%d)", o.Order)
+	}
+	if o.Glob != "" {
+		if _, err := path.Match(o.Glob, ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %s", o.Glob, err)
+		}
+	}
+	return nil
+}
+
+// match reports whether the tag matches the options
+func (o *ListTagOptions) match(tag string) bool {
+	if !strings.HasPrefix(tag, o.Prefix) {
+		return false
+	}
+	if o.Glob != "" {
+		if ok, _ := path.Match(o.Glob, tag); !ok {
+			return false
+		}
+	}
+	if o.Regexp != nil && !o.Regexp.MatchString(tag) {
+		return false
+	}
+	return true
+}
+
+// past reports whether the tags after the tag in the sorted list can't
+// match the options, so the listing can stop early
+func (o *ListTagOptions) past(tag string) bool {
+	for _, prefix := range []string{o.Prefix, globPrefix(o.Glob)} {
+		if prefix != "" && tag > prefix && !strings.HasPrefix(tag, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// seek returns the "last" parameter to start the listing from the tags
+// with the prefix, all of them sort after the prefix without its last
+// character
+func (o *ListTagOptions) seek() string {
+	prefix := o.Prefix
+	if glob := globPrefix(o.Glob); len(glob) > len(prefix) && strings.HasPrefix(glob, prefix) {
+		prefix = glob
+	}
+	if prefix == "" {
+		return ""
+	}
+	return prefix[:len(prefix)-1]
+}
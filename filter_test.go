@@ -0,0 +1,226 @@
+package reglib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// pagedCatalog serves the repositories in the order of the registry, or
+// the tags of any repository, page by page with the Link header, and
+// counts the pages served
+type pagedCatalog struct {
+	repos []string
+	pages int32
+	// the "last" parameter of the first page
+	first atomic.Value
+}
+
+func newPagedCatalog(repos ...string) *pagedCatalog {
+	sort.Slice(repos, func(i, j int) bool {
+		return catalogKey(repos[i]) < catalogKey(repos[j])
+	})
+	return &pagedCatalog{repos: repos}
+}
+
+func (p *pagedCatalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := "repositories"
+	if strings.HasSuffix(r.URL.Path, "/tags/list") {
+		key = "tags"
+	} else if r.URL.Path != "/v2/_catalog" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if atomic.AddInt32(&p.pages, 1) == 1 {
+		p.first.Store(r.URL.Query().Get("last"))
+	}
+	n, err := strconv.Atoi(r.URL.Query().Get("n"))
+	if err != nil || n <= 0 {
+		n = len(p.repos)
+	}
+	last := r.URL.Query().Get("last")
+	i := sort.Search(len(p.repos), func(i int) bool {
+		return catalogKey(p.repos[i]) > catalogKey(last)
+	})
+	page := p.repos[i:]
+	if len(page) > n {
+		page = page[:n]
+		w.Header().Set("Link", fmt.Sprintf(`<%s?last=%s&n=%d>; rel="next"`,
+			r.URL.Path, page[n-1], n))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{key: page})
+}
+
+func listRepoNames(t *testing.T, r Registry, opts *ListRepoOptions) []string {
+	repos, err := r.Repos(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, repo := range repos {
+		names = append(names, repo.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestListRepoFilters(t *testing.T) {
+	catalog := newPagedCatalog("alpine", "busybox", "team/app", "team/sub/api",
+		"team/sub/web", "teamx/app", "tools/jq", "tools/yq")
+	ts := httptest.NewServer(catalog)
+	defer ts.Close()
+
+	r, err := New(ts.URL, WithPageSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name string
+		opts *ListRepoOptions
+		want []string
+	}{
+		{"namespace", &ListRepoOptions{Namespace: "team"},
+			[]string{"team/app", "team/sub/api", "team/sub/web"}},
+		{"nested namespace", &ListRepoOptions{Namespace: "team/sub/"},
+			[]string{"team/sub/api", "team/sub/web"}},
+		{"prefix", &ListRepoOptions{Prefix: "team"},
+			[]string{"team/app", "team/sub/api", "team/sub/web", "teamx/app"}},
+		{"namespace and prefix", &ListRepoOptions{Namespace: "team", Prefix: "team/sub/w"},
+			[]string{"team/sub/web"}},
+		{"glob", &ListRepoOptions{Glob: "t*/app"},
+			[]string{"team/app", "teamx/app"}},
+		{"regexp", &ListRepoOptions{Regexp: regexp.MustCompile(`^tools/.q$`)},
+			[]string{"tools/jq", "tools/yq"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if got := listRepoNames(t, r, c.opts); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+
+	t.Run("namespace of repository", func(t *testing.T) {
+		repos, err := r.Repos(context.Background(), &ListRepoOptions{Namespace: "team/sub"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the first component of the path, whatever the filter is
+		if len(repos) != 2 || repos[0].Namespace != "team" || repos[1].Namespace != "team" {
+			t.Errorf("got %+v", repos)
+		}
+	})
+
+	t.Run("invalid glob", func(t *testing.T) {
+		if _, err := r.Repos(context.Background(), &ListRepoOptions{Glob: "["}); err == nil {
+			t.Error("expect an error")
+		}
+	})
+}
+
+func TestListRepoStopEarly(t *testing.T) {
+	catalog := newPagedCatalog("a/1", "a/2", "b/1", "b/2", "c/1", "c/2", "d/1", "d/2")
+	ts := httptest.NewServer(catalog)
+	defer ts.Close()
+
+	r, err := New(ts.URL, WithPageSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := listRepoNames(t, r, &ListRepoOptions{Prefix: "b/"})
+	if want := []string{"b/1", "b/2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// the third page starts with c/1 which is past the prefix
+	if pages := atomic.LoadInt32(&catalog.pages); pages != 3 {
+		t.Errorf("got %d pages, want 3", pages)
+	}
+}
+
+func TestListRepoCatalogOrder(t *testing.T) {
+	// the registry sorts "app/x" before "app-web"
+	catalog := newPagedCatalog("app-web", "app/x", "b")
+	if catalog.repos[0] != "app/x" {
+		t.Fatalf("got catalog %v", catalog.repos)
+	}
+	ts := httptest.NewServer(catalog)
+	defer ts.Close()
+
+	r, err := New(ts.URL, WithPageSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []*ListRepoOptions{{Prefix: "app-"}, {Glob: "app-*"}} {
+		if got := listRepoNames(t, r, opts); !reflect.DeepEqual(got, []string{"app-web"}) {
+			t.Errorf("%+v: got %v", opts, got)
+		}
+	}
+	if got := listRepoNames(t, r, &ListRepoOptions{Namespace: "app"}); !reflect.DeepEqual(got, []string{"app/x"}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func listTagNames(t *testing.T, r Registry, opts *ListTagOptions) []string {
+	tags, err := r.Tags(context.Background(), "app", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+func TestListTagFilters(t *testing.T) {
+	catalog := newPagedCatalog("1.0", "1.1", "2.0", "2.1", "2.1-rc1", "latest", "main-a1", "main-b2")
+	ts := httptest.NewServer(catalog)
+	defer ts.Close()
+
+	r, err := New(ts.URL, WithPageSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name  string
+		opts  *ListTagOptions
+		want  []string
+		first string
+		pages int32
+	}{
+		{"all", nil, []string{"1.0", "1.1", "2.0", "2.1", "2.1-rc1", "latest", "main-a1", "main-b2"}, "", 4},
+		// starts after "2" and stops at "latest"
+		{"prefix", &ListTagOptions{Prefix: "2."}, []string{"2.0", "2.1", "2.1-rc1"}, "2", 2},
+		{"glob", &ListTagOptions{Glob: "main-*"}, []string{"main-a1", "main-b2"}, "main", 2},
+		{"regexp", &ListTagOptions{Regexp: regexp.MustCompile(`^\d+\.\d+$`)}, []string{"1.0", "1.1", "2.0", "2.1"}, "", 4},
+		{"limit", &ListTagOptions{Limit: 3}, []string{"1.0", "1.1", "2.0"}, "", 2},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			atomic.StoreInt32(&catalog.pages, 0)
+			if got := listTagNames(t, r, c.opts); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+			if first := catalog.first.Load(); first != c.first {
+				t.Errorf("got the first last %q, want %q", first, c.first)
+			}
+			if pages := atomic.LoadInt32(&catalog.pages); pages != c.pages {
+				t.Errorf("got %d pages, want %d", pages, c.pages)
+			}
+		})
+	}
+
+	for _, opts := range []*ListTagOptions{{Limit: -1}, {Glob: "["}, {Order: TagOrderCreated + 1}} {
+		if _, err := r.Tags(context.Background(), "app", opts); err == nil {
+			t.Errorf("expect an error of %+v", opts)
+		}
+	}
+}
@@ -1,13 +1,24 @@
 module github.com/wrfly/reglib
 
-go 1.13
+go 1.19
 
 require (
 	github.com/docker/distribution v2.8.0+incompatible
-	github.com/docker/go-metrics v0.0.1 // indirect
+	github.com/docker/go-metrics v0.0.1
+	github.com/opencontainers/go-digest v1.0.0-rc1
+	github.com/prometheus/client_golang v1.1.0
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/docker/libtrust v0.0.0-20160708172513-aabc10ec26b7 // indirect
+	github.com/golang/protobuf v1.3.2 // indirect
 	github.com/gorilla/mux v1.7.3 // indirect
-	github.com/opencontainers/go-digest v1.0.0-rc1 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
 	github.com/opencontainers/image-spec v1.0.1 // indirect
+	github.com/prometheus/client_model v0.0.0-20190129233127-fd36f4220a90 // indirect
+	github.com/prometheus/common v0.6.0 // indirect
+	github.com/prometheus/procfs v0.0.3 // indirect
 	github.com/sirupsen/logrus v1.4.2 // indirect
+	golang.org/x/sys v0.0.0-20190801041406-cbf593c0f2f3 // indirect
 )
@@ -0,0 +1,104 @@
+package reglib
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// the registries on the loopback addresses are insecure by default,
+// like the docker daemon
+var defaultInsecureRegistries = []string{"127.0.0.0/8", "::1/128"}
+
+// the timeout of resolving the hostname to match the CIDRs
+const insecureLookupTimeout = 5 * time.Second
+
+// insecureRegistries matches the hosts by the docker's insecure-registries
+// semantics, an entry is either a "host[:port]" or a CIDR
+type insecureRegistries struct {
+	hosts map[string]bool
+	nets  []*net.IPNet
+	// resolve is true if there are the CIDRs other than the default ones,
+	// the hostnames are resolved to match them then
+	resolve bool
+	logger  Logger
+}
+
+func newInsecureRegistries(entries []string) (*insecureRegistries, error) {
+	r := &insecureRegistries{hosts: make(map[string]bool), logger: nopLogger{}}
+	for _, entry := range entries {
+		if strings.Contains(entry, "://") {
+			entry = normalizeHost(entry)
+		}
+		if strings.Contains(entry, "/") {
+			_, ipNet, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("bad insecure registry %s: %s", entry, err)
+			}
+			r.nets = append(r.nets, ipNet)
+			r.resolve = r.resolve || !isDefaultInsecure(ipNet)
+			continue
+		}
+		r.hosts[entry] = true
+	}
+	return r, nil
+}
+
+func isDefaultInsecure(ipNet *net.IPNet) bool {
+	for _, entry := range defaultInsecureRegistries {
+		if _, defaultNet, _ := net.ParseCIDR(entry); defaultNet.String() == ipNet.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether the host is insecure, "localhost" matches the
+// loopback addresses, and the other hostnames are resolved to match the
+// CIDRs only if there are the CIDRs other than the default ones
+func (r *insecureRegistries) match(ctx context.Context, host string) bool {
+	if r.hosts[host] {
+		return true
+	}
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if r.hosts[hostname] {
+		return true
+	}
+	if len(r.nets) == 0 {
+		return false
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(strings.Trim(hostname, "[]")); ip != nil {
+		ips = []net.IP{ip}
+	} else if hostname == "localhost" {
+		ips = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	} else if !r.resolve {
+		return false
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, insecureLookupTimeout)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, hostname)
+		if err != nil {
+			r.logger.Debug("resolve insecure registry error",
+				"host", hostname, "error", err)
+			return false
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		for _, ipNet := range r.nets {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package reglib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestInsecureRegistries(t *testing.T) {
+	r, err := newInsecureRegistries([]string{
+		"myreg:5000", "http://other", "10.0.0.0/8", "fd00::/8",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for host, want := range map[string]bool{
+		"myreg:5000":        true,
+		"myreg":             false,
+		"other:443":         true,
+		"10.1.2.3:5000":     true,
+		"[fd00::1]:5000":    true,
+		"11.1.2.3":          false,
+		"r.kfd.me":          false,
+		"localhost.invalid": false,
+	} {
+		if got := r.match(context.Background(), host); got != want {
+			t.Errorf("match %s got %v", host, got)
+		}
+	}
+	if !r.resolve {
+		t.Error("expect resolving the hostnames for the CIDRs")
+	}
+
+	if _, err := newInsecureRegistries([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("expect an error")
+	}
+}
+
+func TestDefaultInsecureRegistries(t *testing.T) {
+	r, err := newInsecureRegistries(defaultInsecureRegistries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the hostnames are not resolved for the loopback CIDRs
+	if r.resolve {
+		t.Error("expect not resolving the hostnames")
+	}
+	for host, want := range map[string]bool{
+		"localhost:5000":  true,
+		"127.0.0.1:5000":  true,
+		"[::1]:5000":      true,
+		"r.kfd.me":        false,
+		"192.168.1.1:443": false,
+	} {
+		if got := r.match(context.Background(), host); got != want {
+			t.Errorf("match %s got %v", host, got)
+		}
+	}
+}
+
+func TestInsecureFallback(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(catalogHandler))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+
+	t.Run("loopback by default", func(t *testing.T) {
+		// without the scheme, it's https by default
+		r, err := New(u.Host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := catalogOf(r); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("host", func(t *testing.T) {
+		if err := getCatalog(u.Host, WithInsecureRegistries(u.Host)); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("secure", func(t *testing.T) {
+		if err := getCatalog(u.Host); err == nil {
+			t.Error("expect an error")
+		}
+	})
+
+	t.Run("explicit http", func(t *testing.T) {
+		if err := getCatalog(ts.URL); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestInsecureSkipVerify(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(catalogHandler))
+	defer ts.Close()
+	if err := getCatalog(ts.URL, WithInsecureRegistries("127.0.0.1")); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,424 @@
+package reglib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// RepoIterator iterates the repositories of the catalog page by page,
+// the pages are requested on demand by Next, e.g.
+//
+//	it, err := cli.IterRepos(ctx, nil)
+//	if err != nil {
+//		return err
+//	}
+//	defer it.Close()
+//	for it.Next(ctx) {
+//		repo := it.Value()
+//		...
+//	}
+//	return it.Err()
+type RepoIterator struct {
+	c     *Client
+	opts  *ListRepoOptions
+	pager *pager
+	// the ctx of the span
+	ctx  context.Context
+	span Span
+
+	names []string
+	// the number of the matched repositories
+	count int
+	// listed is true if there are no more names, listErr is the error
+	// which stopped the listing
+	listed  bool
+	listErr error
+
+	// the repositories whose tags are being fetched ahead, in the order
+	// of the catalog, the fetching is canceled when the iterator is done
+	pending []*pendingRepo
+	cancel  context.CancelFunc
+
+	repo Repository
+	err  error
+	done bool
+}
+
+type pendingRepo struct {
+	repo Repository
+	done chan struct{}
+}
+
+// IterRepos returns the iterator of the repositories, the ctx is used
+// for the tracing span of the listing and the tags fetched ahead, and
+// the ctx of Next is used for the other requests
+func (c *Client) IterRepos(ctx context.Context, opts *ListRepoOptions) (*RepoIterator, error) {
+	if opts == nil {
+		opts = &ListRepoOptions{}
+	} else if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if caps, ok := c.capabilities(); ok && caps.Catalog == Unsupported {
+		return nil, fmt.Errorf("list repositories of %s error: catalog %w",
+			c.Host(), ErrUnsupported)
+	}
+
+	// the span ends when the iterator is done
+	ctx, span := c.startSpan(ctx, "reglib.Repos", "with_tags", opts.WithTags)
+	it := &RepoIterator{
+		c:     c,
+		opts:  opts,
+		pager: c.newPager("/v2/_catalog", ""),
+		span:  span,
+	}
+	it.ctx, it.cancel = context.WithCancel(ctx)
+	return it, nil
+}
+
+// Next advances to the next repository, it returns false when the
+// listing is done or failed, check Err for the error then
+func (it *RepoIterator) Next(ctx context.Context) bool {
+	if it.done {
+		return false
+	}
+	ctx = withValues(ctx, it.ctx)
+	if !it.opts.WithTags {
+		name, ok := it.nextName(ctx)
+		if !ok {
+			it.finish(it.listErr)
+			return false
+		}
+		it.repo = it.c.newRepository(ctx, name, false)
+		return true
+	}
+
+	workers := it.opts.Workers
+	if workers == 0 {
+		workers = defaultTagWorkers
+	}
+	for len(it.pending) < workers {
+		name, ok := it.nextName(ctx)
+		if !ok {
+			break
+		}
+		it.pending = append(it.pending, it.fetch(name))
+	}
+	if len(it.pending) == 0 {
+		it.finish(it.listErr)
+		return false
+	}
+	p := it.pending[0]
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		it.finish(ctx.Err())
+		return false
+	}
+	it.pending = it.pending[1:]
+	it.repo = p.repo
+	return true
+}
+
+// nextName returns the name of the next repository matching the
+// options, it's false if there are no more repositories
+func (it *RepoIterator) nextName(ctx context.Context) (string, bool) {
+	for !it.listed {
+		if len(it.names) == 0 {
+			names, err := it.pager.page(ctx)
+			if err != nil {
+				it.stopListing(err)
+				break
+			}
+			it.names = names
+			continue
+		}
+
+		name := it.names[0]
+		it.names = it.names[1:]
+		// the catalog is sorted, nothing matches after it
+		if it.opts.past(name) {
+			it.stopListing(nil)
+			break
+		}
+		if !it.opts.match(name) {
+			continue
+		}
+		i := it.count
+		it.count++
+		if i < it.opts.Start {
+			continue
+		}
+		if it.opts.End > 0 && i >= it.opts.End {
+			it.stopListing(nil)
+			break
+		}
+		return name, true
+	}
+	return "", false
+}
+
+func (it *RepoIterator) stopListing(err error) {
+	it.listed = true
+	it.names = nil
+	if err != io.EOF {
+		it.listErr = err
+	}
+}
+
+// fetch fetches the tags of the repository in the background
+func (it *RepoIterator) fetch(name string) *pendingRepo {
+	p := &pendingRepo{done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		p.repo = it.c.newRepository(it.ctx, name, true)
+	}()
+	return p
+}
+
+// Value returns the current repository
+func (it *RepoIterator) Value() Repository {
+	return it.repo
+}
+
+// Err returns the error which stopped the listing
+func (it *RepoIterator) Err() error {
+	return it.err
+}
+
+// Close stops the listing and the fetching of the tags, it's safe to
+// call it more than once
+func (it *RepoIterator) Close() {
+	it.finish(nil)
+}
+
+func (it *RepoIterator) finish(err error) {
+	if it.done {
+		return
+	}
+	it.done = true
+	it.stopListing(nil)
+	it.pending = nil
+	it.cancel()
+	if err != nil {
+		it.c.logger.Error("list repositories error", "host", it.c.Host(), "error", err)
+		it.err = err
+	}
+	endSpan(it.span, err)
+}
+
+// newRepository returns the repository, and lists its tags if withTags
+func (c *Client) newRepository(ctx context.Context, name string, withTags bool) Repository {
+	repo := Repository{
+		Name:      name,
+		Namespace: strings.Split(name, "/")[0],
+		cli:       c,
+	}
+	if withTags {
+		repo.tags, repo.tagErr = c.Tags(ctx, name, nil)
+	}
+	return repo
+}
+
+// TagIterator iterates the tags of a repository page by page, the pages
+// are requested on demand by Next unless the tags are sorted by the
+// options, the usage is the same as RepoIterator
+type TagIterator struct {
+	c     *Client
+	repo  string
+	opts  *ListTagOptions
+	pager *pager
+	// the ctx of the span
+	ctx  context.Context
+	span Span
+
+	names []string
+	// the number of the listed tags
+	count int
+	// listed is true if there are no more pages, listErr is the error
+	// which stopped the listing
+	listed  bool
+	listErr error
+	sorted  bool
+
+	tag  Tag
+	err  error
+	done bool
+}
+
+// IterTags returns the iterator of the tags of the repo, the repo can be
+// an image reference, the ctx is used for the tracing span of the
+// listing, and the ctx of Next is used for the requests
+func (c *Client) IterTags(ctx context.Context, repo string, opts *ListTagOptions) (*TagIterator, error) {
+	if opts == nil {
+		opts = &ListTagOptions{}
+	} else if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	ref, err := c.reference(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	// the span ends when the iterator is done
+	ctx, span := c.startSpan(ctx, "reglib.Tags", "repo", ref.Repository)
+	return &TagIterator{
+		c:     c,
+		repo:  ref.Repository,
+		opts:  opts,
+		pager: c.newPager("/v2/"+ref.Repository+"/tags/list", opts.seek()),
+		ctx:   ctx,
+		span:  span,
+	}, nil
+}
+
+// Next advances to the next tag, it returns false when the listing is
+// done or failed, check Err for the error then
+func (it *TagIterator) Next(ctx context.Context) bool {
+	if it.done {
+		return false
+	}
+	ctx = withValues(ctx, it.ctx)
+	if it.opts.Order != TagOrderDefault && !it.sorted {
+		if err := it.sort(ctx); err != nil {
+			it.finish(err)
+			return false
+		}
+	}
+	if it.opts.Limit > 0 && it.count >= it.opts.Limit {
+		it.finish(nil)
+		return false
+	}
+
+	name, ok := it.nextName(ctx)
+	if !ok {
+		it.finish(it.listErr)
+		return false
+	}
+	it.count++
+	it.tag = Tag{
+		FullName: it.repo + ":" + name,
+		Name:     name,
+		RepoName: it.repo,
+		cli:      it.c,
+	}
+	if it.opts.WithManifest {
+		it.tag.image, it.tag.imgErr = it.c.Image(ctx, it.repo, name)
+	}
+	return true
+}
+
+// nextName returns the next tag matching the options, it's false if
+// there are no more tags
+func (it *TagIterator) nextName(ctx context.Context) (string, bool) {
+	for {
+		if len(it.names) == 0 {
+			if it.listed {
+				return "", false
+			}
+			names, err := it.pager.page(ctx)
+			if err != nil {
+				it.stopListing(err)
+				return "", false
+			}
+			it.names = names
+			continue
+		}
+
+		name := it.names[0]
+		it.names = it.names[1:]
+		if it.sorted {
+			return name, true
+		}
+		// the tags are sorted, nothing matches after it
+		if it.opts.past(name) {
+			it.stopListing(nil)
+			it.names = nil
+			return "", false
+		}
+		if it.opts.match(name) {
+			return name, true
+		}
+	}
+}
+
+// sort lists all the tags matching the options and sorts them
+func (it *TagIterator) sort(ctx context.Context) error {
+	names := []string{}
+	for {
+		name, ok := it.nextName(ctx)
+		if !ok {
+			break
+		}
+		names = append(names, name)
+	}
+	if it.listErr != nil {
+		return it.listErr
+	}
+
+	var created map[string]time.Time
+	if it.opts.Order == TagOrderCreated {
+		var err error
+		if created, err = it.c.tagsCreated(ctx, it.repo, names); err != nil {
+			return err
+		}
+	}
+	sortTags(names, it.opts.Order, it.opts.Reverse, created)
+	it.names = names
+	it.sorted = true
+	return nil
+}
+
+func (it *TagIterator) stopListing(err error) {
+	it.listed = true
+	if err != io.EOF {
+		it.listErr = err
+	}
+}
+
+// Value returns the current tag
+func (it *TagIterator) Value() Tag {
+	return it.tag
+}
+
+// Err returns the error which stopped the listing
+func (it *TagIterator) Err() error {
+	return it.err
+}
+
+// Close stops the listing, it's safe to call it more than once
+func (it *TagIterator) Close() {
+	it.finish(nil)
+}
+
+func (it *TagIterator) finish(err error) {
+	if it.done {
+		return
+	}
+	it.done = true
+	it.listed = true
+	it.names = nil
+	it.err = err
+	endSpan(it.span, err)
+}
+
+// valuesContext is the ctx whose values are looked up in the values ctx
+// first, it's used to trace the requests of Next within the span of the
+// listing while they are canceled by the ctx of Next
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+func withValues(ctx, values context.Context) context.Context {
+	return valuesContext{Context: ctx, values: values}
+}
+
+func (c valuesContext) Value(key interface{}) interface{} {
+	if v := c.values.Value(key); v != nil {
+		return v
+	}
+	return c.Context.Value(key)
+}
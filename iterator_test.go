@@ -0,0 +1,273 @@
+package reglib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRepoIterator(t *testing.T) {
+	catalog := newPagedCatalog("a", "b", "c", "d", "e")
+	ts := httptest.NewServer(catalog)
+	defer ts.Close()
+
+	r, err := New(ts.URL, WithPageSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	t.Run("all", func(t *testing.T) {
+		it, err := r.IterRepos(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer it.Close()
+		names := []string{}
+		for it.Next(ctx) {
+			names = append(names, it.Value().Name)
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"a", "b", "c", "d", "e"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("got %v, want %v", names, want)
+		}
+	})
+
+	t.Run("on demand", func(t *testing.T) {
+		atomic.StoreInt32(&catalog.pages, 0)
+		it, err := r.IterRepos(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !it.Next(ctx) || it.Value().Name != "a" {
+			t.Fatalf("got %v", it.Value())
+		}
+		it.Close()
+		if it.Next(ctx) {
+			t.Error("expect no more repos after closed")
+		}
+		if n := atomic.LoadInt32(&catalog.pages); n != 1 {
+			t.Errorf("got %d pages, want 1", n)
+		}
+	})
+
+	t.Run("start and end", func(t *testing.T) {
+		got := listRepoNames(t, r, &ListRepoOptions{Start: 1, End: 4})
+		if want := []string{"b", "c", "d"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+}
+
+func TestRepoIteratorError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeRegistryError(w, http.StatusForbidden, "DENIED", "no catalog")
+	}))
+	defer ts.Close()
+
+	r, err := New(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	it, err := r.IterRepos(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	if it.Next(ctx) {
+		t.Fatal("expect no repos")
+	}
+	if !errors.Is(it.Err(), ErrDenied) {
+		t.Errorf("got error %v", it.Err())
+	}
+}
+
+func TestReposChanCancel(t *testing.T) {
+	ts := httptest.NewServer(newPagedCatalog("a", "b", "c"))
+	defer ts.Close()
+
+	r, err := New(ts.URL, WithPageSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	repos, err := r.ReposChan(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-repos
+	cancel()
+
+	// the channel is closed without being drained
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-repos:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("the channel is not closed after canceled")
+		}
+	}
+}
+
+func TestReposChanDottedNamespace(t *testing.T) {
+	catalog := newPagedCatalog("my.team/app", "my.team/sub/api")
+	ts := httptest.NewServer(catalog)
+	defer ts.Close()
+
+	r, err := New(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err := r.Tags(context.Background(), "my.team/app:latest", nil)
+	if err != nil || len(tags) != 2 || tags[0].RepoName != "my.team/app" {
+		t.Errorf("got tags %+v, error %v", tags, err)
+	}
+
+	repos, err := r.ReposChan(context.Background(), &ListRepoOptions{WithTags: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for repo := range repos {
+		tags, err := repo.Tags()
+		if err != nil || len(tags) != 2 || tags[0].RepoName != repo.Name {
+			t.Errorf("got tags %+v of %s, error %v", tags, repo.Name, err)
+		}
+		names = append(names, repo.Name)
+	}
+	if want := []string{"my.team/app", "my.team/sub/api"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+}
+
+func TestTagIterator(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/alpine/tags/list":
+			w.Write([]byte(`{"name":"alpine","tags":["3.18","3.19"]}`))
+		default:
+			writeRegistryError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+		}
+	}))
+	defer ts.Close()
+
+	r, err := New(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	it, err := r.IterTags(ctx, "alpine:latest", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	names := []string{}
+	for it.Next(ctx) {
+		tag := it.Value()
+		if tag.RepoName != "alpine" || tag.FullName != "alpine:"+tag.Name {
+			t.Errorf("got tag %+v", tag)
+		}
+		names = append(names, tag.Name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"3.18", "3.19"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+
+	it, err = r.IterTags(ctx, "unknown", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	if it.Next(ctx) || !errors.Is(it.Err(), ErrNotFound) {
+		t.Errorf("got error %v", it.Err())
+	}
+}
+
+func TestReposWithTagsOrder(t *testing.T) {
+	catalog := newPagedCatalog("a", "b", "c", "d", "e", "f", "g", "h")
+	var running, maxRunning int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/_catalog" {
+			catalog.ServeHTTP(w, r)
+			return
+		}
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		// the tags of the former repositories are slower
+		name := strings.Split(r.URL.Path, "/")[2]
+		time.Sleep(time.Duration('h'-name[0]) * 5 * time.Millisecond)
+		w.Write([]byte(`{"name":"` + name + `","tags":["latest"]}`))
+	}))
+	defer ts.Close()
+
+	r, err := New(ts.URL, WithPageSize(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos, err := r.Repos(context.Background(), &ListRepoOptions{
+		WithTags: true,
+		Workers:  3,
+		Start:    2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, repo := range repos {
+		tags, err := repo.Tags()
+		if err != nil || len(tags) != 1 || tags[0].RepoName != repo.Name {
+			t.Errorf("got tags %v of %s, error %v", tags, repo.Name, err)
+		}
+		names = append(names, repo.Name)
+	}
+	if want := []string{"c", "d", "e", "f", "g", "h"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+	if max := atomic.LoadInt32(&maxRunning); max > 3 {
+		t.Errorf("got %d concurrent tag requests, want at most 3", max)
+	}
+}
+
+func TestListRepoOptionsValidate(t *testing.T) {
+	for _, opts := range []*ListRepoOptions{
+		{Start: -1},
+		{Start: 10, End: 5},
+		{Workers: -1},
+		{Glob: "[a"},
+	} {
+		if err := opts.validate(); err == nil {
+			t.Errorf("expect an error of %+v", opts)
+		}
+	}
+	for _, opts := range []*ListRepoOptions{
+		{},
+		{Start: 10},
+		{Start: 5, End: 5},
+	} {
+		if err := opts.validate(); err != nil {
+			t.Errorf("%+v: %s", opts, err)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package reglib
+
+// Logger is the structured logger of the client, the keysAndValues are
+// the alternating keys and values of the fields, like "host", "docker.io".
+// *slog.Logger satisfies it, see SlogLogger
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+// NopLogger returns the logger which discards everything, it's the
+// default logger of the client
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
@@ -0,0 +1,15 @@
+//go:build go1.21
+// +build go1.21
+
+package reglib
+
+import "log/slog"
+
+// SlogLogger adapts the *slog.Logger to the Logger, the default
+// slog logger is used if l is nil
+func SlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return l
+}
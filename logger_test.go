@@ -0,0 +1,83 @@
+package reglib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type logEntry struct {
+	level  string
+	msg    string
+	fields map[string]interface{}
+}
+
+// recordLogger records the log entries
+type recordLogger struct {
+	m       sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordLogger) log(level, msg string, kv []interface{}) {
+	fields := make(map[string]interface{})
+	for i := 0; i+1 < len(kv); i += 2 {
+		fields[kv[i].(string)] = kv[i+1]
+	}
+	l.m.Lock()
+	l.entries = append(l.entries, logEntry{level, msg, fields})
+	l.m.Unlock()
+}
+
+func (l *recordLogger) Debug(msg string, kv ...interface{}) { l.log("debug", msg, kv) }
+func (l *recordLogger) Info(msg string, kv ...interface{})  { l.log("info", msg, kv) }
+func (l *recordLogger) Warn(msg string, kv ...interface{})  { l.log("warn", msg, kv) }
+func (l *recordLogger) Error(msg string, kv ...interface{}) { l.log("error", msg, kv) }
+
+func (l *recordLogger) find(msg string) (logEntry, bool) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	for _, e := range l.entries {
+		if e.msg == msg {
+			return e, true
+		}
+	}
+	return logEntry{}, false
+}
+
+func TestLogger(t *testing.T) {
+	var n int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writeRegistryError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+	}))
+	defer ts.Close()
+
+	l := &recordLogger{}
+	policy := DefaultRetryPolicy
+	policy.MinBackoff = time.Millisecond
+	r, err := New(ts.URL, WithInsecureRegistries(),
+		WithRetryPolicy(policy), WithLogger(l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := r.(*Client)
+	if _, err := r.Repos(context.Background(), nil); err == nil {
+		t.Fatal("expect error")
+	}
+
+	e, ok := l.find("retry request")
+	if !ok || e.level != "debug" || e.fields["host"] != c.registryURL.Host {
+		t.Errorf("bad retry log: %+v", e)
+	}
+	e, ok = l.find("list repositories error")
+	if !ok || e.level != "error" || e.fields["host"] != c.Host() || e.fields["error"] == nil {
+		t.Errorf("bad listing log: %+v", e)
+	}
+}
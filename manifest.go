@@ -7,6 +7,7 @@ import (
 	dis "github.com/docker/distribution"
 	v1 "github.com/docker/distribution/manifest/schema1"
 	v2 "github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
 )
 
 func manifestV1(ctx context.Context, ms dis.ManifestService,
@@ -31,16 +32,20 @@ func manifestV1(ctx context.Context, ms dis.ManifestService,
 	return manifestV1, json.Unmarshal(pld, manifestV1)
 }
 
+// manifestV2 gets the manifest by the digest if it's given, otherwise
+// by the tag
 func manifestV2(ctx context.Context, ms dis.ManifestService,
-	tag string) (*v2.Manifest, error) {
+	tag, dgst string) (*v2.Manifest, error) {
 	manifestV2 := &v2.Manifest{
 		Layers: []dis.Descriptor{},
 	}
-	m, err := ms.Get(ctx, "",
-		dis.WithTag(tag),
-		dis.WithManifestMediaTypes(
-			[]string{v2.MediaTypeManifest},
-		))
+	options := []dis.ManifestServiceOption{
+		dis.WithManifestMediaTypes([]string{v2.MediaTypeManifest}),
+	}
+	if dgst == "" {
+		options = append(options, dis.WithTag(tag))
+	}
+	m, err := ms.Get(ctx, digest.Digest(dgst), options...)
 	if err != nil {
 		return nil, err
 	}
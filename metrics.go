@@ -0,0 +1,84 @@
+package reglib
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the operations of the requests
+const (
+	opPing     = "ping"
+	opCatalog  = "catalog"
+	opTags     = "tags"
+	opManifest = "manifest"
+	opBlob     = "blob"
+	opToken    = "token"
+	opOther    = "other"
+)
+
+// MetricsCollector collects the metrics of the client, the implementations
+// must be safe for concurrent use, see NewPrometheusMetrics
+type MetricsCollector interface {
+	// RequestDone is called when a request to the registry or the token
+	// server is done, the operation is one of "ping", "catalog", "tags",
+	// "manifest", "blob", "token" and "other", the status is the HTTP
+	// status code or "error" if there is no response
+	RequestDone(host, operation, status string, duration time.Duration)
+	// BytesDownloaded counts the bytes of the blobs downloaded
+	BytesDownloaded(host string, n int64)
+	// TokenFetched is called when a token is fetched from the token
+	// server of the registry host
+	TokenFetched(host string, err error)
+	// TokenCacheLookup is called when a token is looked up in the cache
+	TokenCacheLookup(hit bool)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) RequestDone(string, string, string, time.Duration) {}
+func (nopMetrics) BytesDownloaded(string, int64)                     {}
+func (nopMetrics) TokenFetched(string, error)                        {}
+func (nopMetrics) TokenCacheLookup(bool)                             {}
+
+// requestOperation returns the operation of the request by its path,
+// the requests not to the /v2/ API are the token requests
+func requestOperation(req *http.Request) string {
+	path := req.URL.Path
+	i := strings.Index(path+"/", "/v2/")
+	if i < 0 {
+		return opToken
+	}
+	path = path[i+len("/v2"):]
+	switch {
+	case path == "" || path == "/":
+		return opPing
+	case path == "/_catalog":
+		return opCatalog
+	case strings.HasSuffix(path, "/tags/list"):
+		return opTags
+	case strings.Contains(path, "/manifests/"):
+		return opManifest
+	case strings.Contains(path, "/blobs/"):
+		return opBlob
+	}
+	return opOther
+}
+
+// metricsTransport observes the requests sent to the wire
+type metricsTransport struct {
+	next    http.RoundTripper
+	metrics MetricsCollector
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	t.metrics.RequestDone(req.URL.Host, requestOperation(req), status, time.Since(start))
+	return resp, err
+}
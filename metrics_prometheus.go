@@ -0,0 +1,71 @@
+package reglib
+
+import (
+	"time"
+
+	metrics "github.com/docker/go-metrics"
+)
+
+// PrometheusMetrics collects the metrics by the prometheus client, it's a
+// prometheus.Collector, register it by metrics.Register(m.Namespace) or
+// prometheus.MustRegister(m)
+type PrometheusMetrics struct {
+	*metrics.Namespace
+
+	requests     metrics.LabeledCounter
+	latency      metrics.LabeledTimer
+	downloaded   metrics.LabeledCounter
+	tokenFetches metrics.LabeledCounter
+	tokenCache   metrics.LabeledCounter
+}
+
+// NewPrometheusMetrics creates the metrics in the namespace, the metric
+// names are prefixed with "<namespace>_registry_"
+func NewPrometheusMetrics(namespace string) *PrometheusMetrics {
+	ns := metrics.NewNamespace(namespace, "registry", nil)
+	return &PrometheusMetrics{
+		Namespace: ns,
+		requests: ns.NewLabeledCounter("requests",
+			"The number of the requests by host, operation and status",
+			"host", "operation", "status"),
+		latency: ns.NewLabeledTimer("request_duration",
+			"The latency of the requests by host and operation",
+			"host", "operation"),
+		downloaded: ns.NewLabeledCounter("downloaded_bytes",
+			"The bytes of the blobs downloaded by host", "host"),
+		tokenFetches: ns.NewLabeledCounter("token_fetches",
+			"The number of the token fetches by host and result",
+			"host", "result"),
+		tokenCache: ns.NewLabeledCounter("token_cache_lookups",
+			"The number of the token cache lookups by result", "result"),
+	}
+}
+
+// RequestDone implements the MetricsCollector
+func (m *PrometheusMetrics) RequestDone(host, operation, status string, duration time.Duration) {
+	m.requests.WithValues(host, operation, status).Inc()
+	m.latency.WithValues(host, operation).Update(duration)
+}
+
+// BytesDownloaded implements the MetricsCollector
+func (m *PrometheusMetrics) BytesDownloaded(host string, n int64) {
+	m.downloaded.WithValues(host).Inc(float64(n))
+}
+
+// TokenFetched implements the MetricsCollector
+func (m *PrometheusMetrics) TokenFetched(host string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.tokenFetches.WithValues(host, result).Inc()
+}
+
+// TokenCacheLookup implements the MetricsCollector
+func (m *PrometheusMetrics) TokenCacheLookup(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.tokenCache.WithValues(result).Inc()
+}
@@ -0,0 +1,83 @@
+package reglib
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRequestOperation(t *testing.T) {
+	for path, op := range map[string]string{
+		"/v2/":                         opPing,
+		"/v2":                          opPing,
+		"/v2/_catalog":                 opCatalog,
+		"/v2/library/alpine/tags/list": opTags,
+		"/v2/alpine/manifests/latest":  opManifest,
+		"/v2/alpine/blobs/sha256:abc":  opBlob,
+		"/prefix/v2/alpine/tags/list":  opTags,
+		"/token":                       opToken,
+		"/v2/alpine/blobs/uploads/":    opBlob,
+	} {
+		req := &http.Request{URL: &url.URL{Path: path}}
+		if got := requestOperation(req); got != op {
+			t.Errorf("%s: expect %s, got %s", path, op, got)
+		}
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	registry, tokenServer := newTokenRegistry(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"token":"valid"}`))
+	})
+	defer registry.Close()
+	defer tokenServer.Close()
+
+	m := NewPrometheusMetrics("reglib_test")
+	r, err := New(registry.URL, WithMetrics(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := r.Repos(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(m)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counters := make(map[string]float64)
+	for _, f := range families {
+		for _, metric := range f.GetMetric() {
+			labels := []string{f.GetName()}
+			for _, l := range metric.GetLabel() {
+				if l.GetName() != "host" {
+					labels = append(labels, l.GetValue())
+				}
+			}
+			if c := metric.GetCounter(); c != nil {
+				counters[strings.Join(labels, " ")] = c.GetValue()
+			}
+		}
+	}
+
+	for name, expect := range map[string]float64{
+		"reglib_test_registry_requests_total catalog 401":     1,
+		"reglib_test_registry_requests_total catalog 200":     2,
+		"reglib_test_registry_requests_total token 200":       1,
+		"reglib_test_registry_token_fetches_total success":    1,
+		"reglib_test_registry_token_cache_lookups_total miss": 1,
+		"reglib_test_registry_token_cache_lookups_total hit":  1,
+	} {
+		if got := counters[name]; got != expect {
+			t.Errorf("%s: expect %v, got %v", name, expect, got)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package reglib
+
+import "net/http"
+
+// Middleware wraps the transport of the client, it sees every request
+// sent to the registries and the token servers, including the catalog,
+// tags, manifests, blobs and tokens. The requests carry the credentials
+// set by the client and are retried and rate limited below it
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc is an adapter to use a function as the http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req)
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// RequestHook is called before a request is sent, the request can be
+// modified (e.g. set headers), an error aborts the request
+type RequestHook func(req *http.Request) error
+
+// ResponseHook is called after a request is done, either resp or
+// err is nil, the hook must not consume the body
+type ResponseHook func(req *http.Request, resp *http.Response, err error)
+
+// chainMiddlewares wraps tr with the middlewares, the first one is the
+// outermost, the hooks are called inside all the middlewares
+func chainMiddlewares(tr http.RoundTripper, middlewares []Middleware,
+	requestHooks []RequestHook, responseHooks []ResponseHook) http.RoundTripper {
+
+	if len(requestHooks) > 0 || len(responseHooks) > 0 {
+		tr = hooksMiddleware(requestHooks, responseHooks)(tr)
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		tr = middlewares[i](tr)
+	}
+	return tr
+}
+
+func hooksMiddleware(requestHooks []RequestHook, responseHooks []ResponseHook) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if len(requestHooks) > 0 {
+				// the hooks may modify the request
+				req = req.Clone(req.Context())
+				for _, hook := range requestHooks {
+					if err := hook(req); err != nil {
+						return nil, err
+					}
+				}
+			}
+			resp, err := next.RoundTrip(req)
+			for _, hook := range responseHooks {
+				hook(req, resp, err)
+			}
+			return resp, err
+		})
+	}
+}
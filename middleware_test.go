@@ -0,0 +1,83 @@
+package reglib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func headerMiddleware(value string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			req.Header.Add("X-Order", value)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var (
+		m      sync.Mutex
+		orders []string
+		paths  []string
+	)
+	registry, tokenServer := newTokenRegistry(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		orders = append(orders, strings.Join(r.Header.Values("X-Order"), ","))
+		m.Unlock()
+		w.Write([]byte(`{"token":"valid"}`))
+	})
+	defer registry.Close()
+	defer tokenServer.Close()
+
+	r, err := New(registry.URL,
+		WithMiddleware(headerMiddleware("a"), headerMiddleware("b")),
+		WithRequestHook(func(req *http.Request) error {
+			req.Header.Add("X-Order", "hook")
+			return nil
+		}),
+		WithResponseHook(func(req *http.Request, resp *http.Response, err error) {
+			m.Lock()
+			paths = append(paths, req.URL.Path+" "+resp.Status)
+			m.Unlock()
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Repos(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if len(orders) != 1 || orders[0] != "a,b,hook" {
+		t.Errorf("bad middleware order of the token request: %v", orders)
+	}
+	expect := []string{
+		"/v2/_catalog 401 Unauthorized",
+		"/token 200 OK",
+		"/v2/_catalog 200 OK",
+	}
+	if strings.Join(paths, "|") != strings.Join(expect, "|") {
+		t.Errorf("expect requests %v, got %v", expect, paths)
+	}
+}
+
+func TestRequestHookAbort(t *testing.T) {
+	ts, tokenServer := newTokenRegistry(http.NotFound)
+	defer ts.Close()
+	defer tokenServer.Close()
+
+	denied := errors.New("denied by the audit")
+	err := getCatalog(ts.URL, WithRequestHook(func(req *http.Request) error {
+		return denied
+	}))
+	if !errors.Is(err, denied) {
+		t.Errorf("expect the hook error, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package reglib
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// the backoff of a failed mirror, it's doubled on every failure
+	minMirrorBackoff = 10 * time.Second
+	maxMirrorBackoff = 5 * time.Minute
+)
+
+// mirrorEndpoint is a mirror of the registry and its health
+type mirrorEndpoint struct {
+	url *url.URL
+
+	m         sync.Mutex
+	failures  int
+	downUntil time.Time
+}
+
+func (e *mirrorEndpoint) healthy(now time.Time) bool {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return !now.Before(e.downUntil)
+}
+
+func (e *mirrorEndpoint) succeed() {
+	e.m.Lock()
+	e.failures = 0
+	e.downUntil = time.Time{}
+	e.m.Unlock()
+}
+
+// fail marks the mirror down for a while, returns the duration
+func (e *mirrorEndpoint) fail(now time.Time) time.Duration {
+	e.m.Lock()
+	defer e.m.Unlock()
+	backoff := minMirrorBackoff
+	for i := 0; i < e.failures && backoff < maxMirrorBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxMirrorBackoff {
+		backoff = maxMirrorBackoff
+	}
+	e.failures++
+	e.downUntil = now.Add(backoff)
+	return backoff
+}
+
+// request returns a copy of the request sent to the mirror, it's not
+// retried since the next mirror or the registry is tried instead
+func (e *mirrorEndpoint) request(req *http.Request) *http.Request {
+	r := req.Clone(withoutRetry(req.Context()))
+	r.URL.Scheme = e.url.Scheme
+	r.URL.Host = e.url.Host
+	r.URL.Path = e.url.Path + req.URL.Path
+	r.URL.RawPath = ""
+	r.Host = ""
+	return r
+}
+
+// mirrorTransport sends the reads of the manifests, blobs and tags to
+// the mirrors in order and falls back to the registry, the mirrors which
+// fail are skipped for a while, the other requests go to the registry
+type mirrorTransport struct {
+	next    http.RoundTripper
+	host    string
+	mirrors []*mirrorEndpoint
+	logger  Logger
+}
+
+func newMirrorTransport(next http.RoundTripper, host string,
+	mirrors []string, logger Logger) (http.RoundTripper, error) {
+
+	if len(mirrors) == 0 {
+		return next, nil
+	}
+	t := &mirrorTransport{next: next, host: host, logger: logger}
+	for _, mirror := range mirrors {
+		if !strings.Contains(mirror, "://") {
+			mirror = "https://" + mirror
+		}
+		u, err := url.Parse(strings.TrimSuffix(mirror, "/"))
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("bad mirror %s: %v", mirror, err)
+		}
+		t.mirrors = append(t.mirrors, &mirrorEndpoint{url: u})
+	}
+	return t, nil
+}
+
+func (t *mirrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if (req.Method != "GET" && req.Method != "HEAD") || req.URL.Host != t.host ||
+		!repoPathRegexp.MatchString(req.URL.Path) {
+		return t.next.RoundTrip(req)
+	}
+
+	for _, mirror := range t.mirrors {
+		if !mirror.healthy(time.Now()) {
+			continue
+		}
+		resp, err := t.next.RoundTrip(mirror.request(req))
+		if req.Context().Err() != nil {
+			return resp, err
+		}
+		if err == nil && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusTooManyRequests {
+			mirror.succeed()
+			switch resp.StatusCode {
+			case http.StatusNotFound, http.StatusUnauthorized, http.StatusForbidden:
+				// the mirror misses or denies it, try the next one
+				t.logger.Debug("mirror miss", "host", t.host, "mirror", mirror.url.Host,
+					"url", req.URL.String(), "status", resp.StatusCode)
+				drainBody(resp)
+				continue
+			}
+			return resp, nil
+		}
+
+		backoff := mirror.fail(time.Now())
+		t.logger.Warn("mirror unavailable", "host", t.host, "mirror", mirror.url.Host,
+			"cause", statusOrError(resp, err), "backoff", backoff)
+		if resp != nil {
+			drainBody(resp)
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// drainBody reads the rest of the body and closes it, so the
+// connection can be reused
+func drainBody(resp *http.Response) {
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<20))
+	resp.Body.Close()
+}
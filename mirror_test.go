@@ -0,0 +1,145 @@
+package reglib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pathRecorder records the requests and responds the tags
+type pathRecorder struct {
+	m        sync.Mutex
+	requests []string
+	miss     bool
+}
+
+func (p *pathRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.m.Lock()
+	p.requests = append(p.requests, r.Method+" "+r.URL.Path)
+	miss := p.miss
+	p.m.Unlock()
+	if miss {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"name":"app","tags":["v1"],"repositories":["app"]}`))
+}
+
+func (p *pathRecorder) count() int {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return len(p.requests)
+}
+
+func TestMirrors(t *testing.T) {
+	upstream := &pathRecorder{}
+	hit := &pathRecorder{}
+	miss := &pathRecorder{miss: true}
+	upstreamServer := httptest.NewServer(upstream)
+	hitServer := httptest.NewServer(hit)
+	missServer := httptest.NewServer(miss)
+	downServer := httptest.NewServer(http.NotFoundHandler())
+	defer upstreamServer.Close()
+	defer hitServer.Close()
+	defer missServer.Close()
+	downServer.Close()
+
+	r, err := New(upstreamServer.URL, WithoutRetry(),
+		WithMirrors(downServer.URL, missServer.URL, hitServer.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := r.Tags(ctx, "app", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if miss.count() != 2 || hit.count() != 2 || upstream.count() != 0 {
+		t.Errorf("expect the reads to the mirrors, got miss %d, hit %d, upstream %d",
+			miss.count(), hit.count(), upstream.count())
+	}
+
+	c := r.(*Client)
+	if c.transport.(*mirrorTransport).mirrors[0].healthy(time.Now()) {
+		t.Error("the down mirror should be marked unhealthy")
+	}
+
+	// the catalog and the writes go to the registry
+	if _, err := r.Repos(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("DELETE", c.baseURL+"/v2/app/manifests/"+testDigest, nil)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if upstream.count() != 2 || hit.count() != 2 {
+		t.Errorf("expect 2 requests to the registry, got %v", upstream.requests)
+	}
+
+	// all the mirrors miss
+	hit.m.Lock()
+	hit.miss = true
+	hit.m.Unlock()
+	if _, err := r.Tags(ctx, "app", nil); err != nil {
+		t.Fatal(err)
+	}
+	if upstream.count() != 3 {
+		t.Errorf("expect fall back to the registry, got %v", upstream.requests)
+	}
+}
+
+func TestMirrorHealth(t *testing.T) {
+	e := &mirrorEndpoint{}
+	now := time.Now()
+	if !e.healthy(now) {
+		t.Error("a new mirror should be healthy")
+	}
+	for i, expect := range []time.Duration{10, 20, 40, 80, 160, 300, 300} {
+		if backoff := e.fail(now); backoff != expect*time.Second {
+			t.Errorf("failure %d: expect backoff %ds, got %s", i, expect, backoff)
+		}
+	}
+	if e.healthy(now.Add(299*time.Second)) || !e.healthy(now.Add(300*time.Second)) {
+		t.Error("bad health after the backoff")
+	}
+	e.succeed()
+	if !e.healthy(now) || e.fail(now) != minMirrorBackoff {
+		t.Error("the success should reset the health")
+	}
+}
+
+func TestMirrorWithoutRetry(t *testing.T) {
+	upstream := &pathRecorder{}
+	upstreamServer := httptest.NewServer(upstream)
+	defer upstreamServer.Close()
+	var down int32
+	downServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&down, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer downServer.Close()
+
+	r, err := New(upstreamServer.URL, WithMirrors(downServer.URL),
+		WithRetryPolicy(RetryPolicy{
+			MaxRetries: 3,
+			Statuses:   []int{http.StatusServiceUnavailable},
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Tags(context.Background(), "app", nil); err != nil {
+		t.Fatal(err)
+	}
+	// the failed mirror is skipped at once instead of being retried
+	if n := atomic.LoadInt32(&down); n != 1 || upstream.count() != 1 {
+		t.Errorf("got %d requests to the mirror, %d to the registry", n, upstream.count())
+	}
+}
@@ -0,0 +1,175 @@
+package reglib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// the client_id sent to the token server, it's required by the OAuth2
+// flow and used by the servers to identify the client
+const oauthClientID = "reglib"
+
+// fetchToken exchanges a bearer token from the realm, see
+// https://docs.docker.com/registry/spec/auth/token/ and
+// https://docs.docker.com/registry/spec/auth/oauth/
+//
+// the OAuth2 POST flow is used when there is a refresh token (the identity
+// token or the one returned by the server), otherwise it's the GET flow with
+// basic auth, and falls back to the POST password grant if the server does
+// not support GET
+func (a *author) fetchToken(ctx context.Context, realm, service string,
+	scopes []string, auth AuthConfig) (token, error) {
+
+	// the refresh tokens are of the account, they must not be used after
+	// the credential is rotated to another account
+	key := credentialID(auth) + "|" + realm + "|" + service
+	if refreshToken := a.refreshToken(key, auth); refreshToken != "" {
+		t, err := a.postToken(ctx, realm, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refreshToken},
+		}, service, scopes)
+		if err == nil {
+			a.storeRefreshToken(key, t.RefreshToken)
+			return t, nil
+		}
+		// the kept refresh token may be revoked, forget it and start
+		// over with the identity token or the password
+		if !a.dropRefreshToken(key, refreshToken) {
+			return t, err
+		}
+		return a.fetchToken(ctx, realm, service, scopes, auth)
+	}
+
+	t, err := a.getToken(ctx, realm, service, scopes, auth)
+	if err == errTokenGETUnsupported && auth.Username != "" {
+		t, err = a.postToken(ctx, realm, url.Values{
+			"grant_type": {"password"},
+			"username":   {auth.Username},
+			"password":   {auth.Password},
+		}, service, scopes)
+	}
+	if err != nil {
+		return t, err
+	}
+	a.storeRefreshToken(key, t.RefreshToken)
+	return t, nil
+}
+
+// getToken is the GET flow
+func (a *author) getToken(ctx context.Context, realm, service string,
+	scopes []string, auth AuthConfig) (token, error) {
+
+	req, err := http.NewRequestWithContext(ctx, "GET", realm, nil)
+	if err != nil {
+		return token{}, err
+	}
+	q := req.URL.Query()
+	if service != "" {
+		q.Set("service", service)
+	}
+	for _, scope := range scopes {
+		q.Add("scope", scope)
+	}
+	if auth.Username != "" || auth.Password != "" {
+		req.SetBasicAuth(auth.Username, auth.Password)
+		// ask for a refresh token for the later exchanges
+		q.Set("offline_token", "true")
+		q.Set("client_id", oauthClientID)
+	}
+	req.URL.RawQuery = q.Encode()
+
+	return a.doTokenRequest(req)
+}
+
+// postToken is the OAuth2 POST flow
+func (a *author) postToken(ctx context.Context, realm string, form url.Values,
+	service string, scopes []string) (token, error) {
+
+	form.Set("client_id", oauthClientID)
+	form.Set("access_type", "offline")
+	if service != "" {
+		form.Set("service", service)
+	}
+	if len(scopes) != 0 {
+		form.Set("scope", strings.Join(scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", realm,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	return a.doTokenRequest(req)
+}
+
+func (a *author) doTokenRequest(req *http.Request) (token, error) {
+	t := token{}
+	a.setUserAgent(req)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return t, err
+	}
+	defer resp.Body.Close()
+
+	if req.Method == "GET" && (resp.StatusCode == http.StatusNotFound ||
+		resp.StatusCode == http.StatusMethodNotAllowed) {
+		return t, errTokenGETUnsupported
+	}
+	if resp.StatusCode != http.StatusOK {
+		return t, fmt.Errorf("%s token from %s error: %w", req.Method,
+			req.URL.Host, newRegistryError(resp))
+	}
+	tokenBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return t, err
+	}
+	if err := json.Unmarshal(tokenBytes, &t); err != nil {
+		return t, err
+	}
+	if t.Token == "" {
+		t.Token = t.AccessToken
+	}
+	if t.Token == "" {
+		return t, fmt.Errorf("%s token from %s error: empty token %s",
+			req.Method, req.URL.Host, t.Error)
+	}
+	return t, nil
+}
+
+// refreshToken returns the refresh token kept from the previous exchanges
+// of the account, or the identity token of the credential
+func (a *author) refreshToken(key string, auth AuthConfig) string {
+	a.tokenMutex.RLock()
+	defer a.tokenMutex.RUnlock()
+	if t, exist := a.refreshTokens[key]; exist {
+		return t
+	}
+	return auth.IdentityToken
+}
+
+func (a *author) storeRefreshToken(key, refreshToken string) {
+	if refreshToken == "" {
+		return
+	}
+	a.tokenMutex.Lock()
+	a.refreshTokens[key] = refreshToken
+	a.tokenMutex.Unlock()
+}
+
+// dropRefreshToken forgets the kept refresh token, returns false if it's
+// not a kept one
+func (a *author) dropRefreshToken(key, refreshToken string) bool {
+	a.tokenMutex.Lock()
+	defer a.tokenMutex.Unlock()
+	if a.refreshTokens[key] != refreshToken {
+		return false
+	}
+	delete(a.refreshTokens, key)
+	return true
+}
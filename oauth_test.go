@@ -0,0 +1,165 @@
+package reglib
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newTokenRegistry returns a registry which authenticates by the bearer
+// tokens issued from the token server handled by tokenHandler
+func newTokenRegistry(tokenHandler http.HandlerFunc) (registry, tokenServer *httptest.Server) {
+	tokenServer = httptest.NewServer(tokenHandler)
+	registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer valid" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer realm="%s/token",service="test",scope="registry:catalog:*"`,
+				tokenServer.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"repositories":["alpine"]}`))
+	}))
+	return registry, tokenServer
+}
+
+func TestOAuthRefreshToken(t *testing.T) {
+	var (
+		m      sync.Mutex
+		grants []string
+	)
+	registry, tokenServer := newTokenRegistry(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		if r.Method != "POST" || r.FormValue("grant_type") != "refresh_token" ||
+			r.FormValue("service") != "test" || r.FormValue("client_id") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		grants = append(grants, r.FormValue("refresh_token"))
+		fmt.Fprintf(w, `{"access_token":"valid","refresh_token":"refresh-%d"}`, len(grants))
+	})
+	defer registry.Close()
+	defer tokenServer.Close()
+
+	creds := CredentialsFunc(func(context.Context, string) (AuthConfig, error) {
+		return AuthConfig{IdentityToken: "identity"}, nil
+	})
+	r, err := NewWithCredentials(registry.URL, creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		repos, err := r.Repos(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(repos) != 1 {
+			t.Errorf("got repos %v", repos)
+		}
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if len(grants) == 0 || grants[0] != "identity" {
+		t.Fatalf("got grants %v", grants)
+	}
+	for i, g := range grants[1:] {
+		if g != fmt.Sprintf("refresh-%d", i+1) {
+			t.Errorf("the returned refresh token is not used: %v", grants)
+		}
+	}
+}
+
+func TestOAuthRefreshTokenRotate(t *testing.T) {
+	var (
+		m      sync.Mutex
+		user   = "alice"
+		grants []string
+	)
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		refreshToken := r.FormValue("refresh_token")
+		grants = append(grants, refreshToken)
+		// id-alice and refresh-alice are of alice
+		owner := refreshToken[strings.Index(refreshToken, "-")+1:]
+		fmt.Fprintf(w, `{"access_token":"tok-%s","refresh_token":"refresh-%s"}`, owner, owner)
+	}))
+	defer tokenServer.Close()
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		current := user
+		m.Unlock()
+		if r.Header.Get("Authorization") != "Bearer tok-"+current {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer realm="%s/token",service="test",scope="registry:catalog:*"`,
+				tokenServer.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"repositories":["alpine"]}`))
+	}))
+	defer registry.Close()
+
+	creds := CredentialsFunc(func(context.Context, string) (AuthConfig, error) {
+		m.Lock()
+		defer m.Unlock()
+		return AuthConfig{IdentityToken: "id-" + user}, nil
+	})
+	r, err := NewWithCredentials(registry.URL, creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, next := range []string{"alice", "bob"} {
+		m.Lock()
+		user = next
+		m.Unlock()
+		if _, err := r.Repos(context.Background(), nil); err != nil {
+			t.Fatalf("%s: %s", next, err)
+		}
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	for _, g := range grants {
+		if g == "refresh-alice" {
+			t.Errorf("the refresh token of alice is used by bob: %v", grants)
+		}
+	}
+}
+
+func TestOAuthPasswordGrant(t *testing.T) {
+	registry, tokenServer := newTokenRegistry(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.FormValue("grant_type") != "password" ||
+			r.FormValue("username") != "admin" || r.FormValue("password") != "admin123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"access_token":"valid"}`))
+	})
+	defer registry.Close()
+	defer tokenServer.Close()
+
+	r, err := NewWithAuth(registry.URL, "admin", "admin123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos, err := r.Repos(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 {
+		t.Errorf("got repos %v", repos)
+	}
+}
@@ -0,0 +1,240 @@
+package reglib
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"time"
+)
+
+// Option configures the Client
+type Option func(*Client)
+
+// WithCredentials sets the provider of the credentials
+func WithCredentials(creds Credentials) Option {
+	return func(c *Client) {
+		c.creds = creds
+	}
+}
+
+// WithBasicAuth uses the username and password for the registry
+func WithBasicAuth(username, password string) Option {
+	return WithCredentials(StaticCredentials(username, password))
+}
+
+// WithTransport sets the base transport of the requests, the TLS, certs
+// dir, insecure registries and max connections options are not applied
+// to it
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		c.baseTransport = rt
+	}
+}
+
+// WithTimeout sets the timeout of each HTTP request (10s by default),
+// including reading the response body, zero means no timeout
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithLoadTimeout sets the timeout of the lazy loadings which have no
+// context, like Repository.Tags and Tag.Image (5s by default)
+func WithLoadTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.loadTimeout = timeout
+	}
+}
+
+// WithUserAgent sets the User-Agent header of the requests
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		c.userAgent = ua
+	}
+}
+
+// WithPageSize sets the number of repositories or tags requested per
+// page when listing the catalog or the tags (50 by default), the
+// registry may respond less than it
+func WithPageSize(n int) Option {
+	return func(c *Client) {
+		c.pageSize = n
+	}
+}
+
+// WithMaxConnsPerHost limits the connections to each host
+// (50 by default), zero means no limit
+func WithMaxConnsPerHost(n int) Option {
+	return func(c *Client) {
+		c.maxConnsPerHost = n
+	}
+}
+
+// WithRateLimit limits the requests to each host to rps requests per
+// second with bursts of burst requests, it's unlimited by default
+func WithRateLimit(rps float64, burst int) Option {
+	return func(c *Client) {
+		c.rateLimit = rps
+		c.rateBurst = burst
+	}
+}
+
+// WithMaxConcurrency limits the requests in flight of the client,
+// including the listing, tags, manifests and the blob ranges, a request
+// is in flight until its response body is closed. It's 50 by default,
+// zero means no limit
+func WithMaxConcurrency(n int) Option {
+	return func(c *Client) {
+		c.maxConcurrency = n
+	}
+}
+
+// WithProxy sends all the requests of the client through the proxy, the
+// proxy is an HTTP(S) or SOCKS5 URL like "socks5://127.0.0.1:1080", use it
+// with the WithHostOptions of the Resolver to set the per-registry proxy.
+// The proxies are read from the environment by default
+func WithProxy(proxy string) Option {
+	return func(c *Client) {
+		c.proxy = &ProxyConfig{HTTPProxy: proxy, HTTPSProxy: proxy}
+	}
+}
+
+// WithProxyConfig sets the proxies and the hosts not to proxy
+func WithProxyConfig(cfg ProxyConfig) Option {
+	return func(c *Client) {
+		c.proxy = &cfg
+	}
+}
+
+// WithoutProxy ignores the proxy environment variables
+func WithoutProxy() Option {
+	return func(c *Client) {
+		c.proxy = &ProxyConfig{}
+	}
+}
+
+// WithMirrors sets the mirrors of the registry like the registry-mirrors
+// of the docker daemon, the reads of the manifests, blobs and tags try the
+// mirrors in order and fall back to the registry if they miss or fail,
+// the mirrors are not retried, the failed ones are skipped for a while.
+// The other requests always go to the registry. A mirror is a URL, https
+// is used if no scheme
+func WithMirrors(mirrors ...string) Option {
+	return func(c *Client) {
+		c.mirrors = mirrors
+	}
+}
+
+// WithMiddleware appends the middlewares of the transport, the first one
+// is the outermost, see Middleware
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(c *Client) {
+		c.middlewares = append(c.middlewares, middlewares...)
+	}
+}
+
+// WithRequestHook appends the hooks called before every request is sent
+func WithRequestHook(hooks ...RequestHook) Option {
+	return func(c *Client) {
+		c.requestHooks = append(c.requestHooks, hooks...)
+	}
+}
+
+// WithResponseHook appends the hooks called after every request is done
+func WithResponseHook(hooks ...ResponseHook) Option {
+	return func(c *Client) {
+		c.responseHooks = append(c.responseHooks, hooks...)
+	}
+}
+
+// WithRetryPolicy sets the retry policy of the idempotent requests,
+// DefaultRetryPolicy is used by default
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.retryPolicy = p
+	}
+}
+
+// WithoutRetry disables retrying the failed requests
+func WithoutRetry() Option {
+	return func(c *Client) {
+		c.retryPolicy = RetryPolicy{}
+	}
+}
+
+// WithMetrics sets the collector of the metrics, see NewPrometheusMetrics
+func WithMetrics(m MetricsCollector) Option {
+	return func(c *Client) {
+		c.metrics = m
+	}
+}
+
+// WithTracer sets the tracer of the operations and the requests
+func WithTracer(t Tracer) Option {
+	return func(c *Client) {
+		c.tracer = t
+	}
+}
+
+// WithLogger sets the structured logger of the client, nothing is
+// logged by default
+func WithLogger(l Logger) Option {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
+
+// WithTokenCacheFile persists the bearer tokens to the file, so the
+// tokens can be reused between the invocations of the CLI tools
+func WithTokenCacheFile(path string) Option {
+	return func(c *Client) {
+		c.tokenCacheFile = path
+	}
+}
+
+// WithTLSConfig sets the base TLS config of the connections
+// to the registries
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = cfg.Clone()
+	}
+}
+
+// WithRootCAs sets the CAs to verify the registries, the CAs in the
+// certs dir of the host are added to them
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(c *Client) {
+		c.tls().RootCAs = pool
+	}
+}
+
+// WithClientCertificate adds a client certificate for the registries
+// which require mTLS
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(c *Client) {
+		cfg := c.tls()
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+}
+
+// WithCertsDir loads the CAs (*.crt) and the client certificates (*.cert
+// and *.key) of a registry from <dir>/<host>/ like the docker daemon does,
+// the default dir is /etc/docker/certs.d, an empty dir disables it
+func WithCertsDir(dir string) Option {
+	return func(c *Client) {
+		c.certsDir = dir
+	}
+}
+
+// WithInsecureRegistries sets the insecure registries by the docker's
+// insecure-registries semantics, an entry is a "host[:port]" or a CIDR,
+// the TLS verification of the insecure registries is skipped and the
+// requests fall back to plain HTTP if HTTPS fails. The list replaces the
+// default one which contains the loopback addresses, so calling it
+// without args makes all the registries secure.
+func WithInsecureRegistries(registries ...string) Option {
+	return func(c *Client) {
+		c.insecureRegistries = registries
+	}
+}
@@ -0,0 +1,70 @@
+package reglib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingTransport struct {
+	n int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.n, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestOptions(t *testing.T) {
+	var ua, pageSize atomic.Value
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+			return
+		}
+		ua.Store(r.UserAgent())
+		pageSize.Store(r.URL.Query().Get("n"))
+		catalogHandler(w, r)
+	}))
+	defer ts.Close()
+
+	tr := &countingTransport{}
+	r, err := New(ts.URL,
+		WithUserAgent("reglib-test"),
+		WithPageSize(10),
+		WithTransport(tr),
+		WithTimeout(50*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Repos(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if ua.Load() != "reglib-test" || pageSize.Load() != "10" {
+		t.Errorf("got user agent %v and page size %v", ua.Load(), pageSize.Load())
+	}
+	if atomic.LoadInt32(&tr.n) == 0 {
+		t.Error("the base transport is not used")
+	}
+
+	c := r.(*Client)
+	if _, err := c.client.Get(c.baseURL + "/slow"); err == nil {
+		t.Error("expect a timeout error")
+	}
+}
+
+func TestDefaultOptions(t *testing.T) {
+	r, err := New("r.kfd.me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := r.(*Client)
+	if c.baseURL != "https://r.kfd.me" || c.pageSize != defaultPageSize ||
+		c.timeout != defaultTimeout || c.loadTimeout != defaultLoadTimeout {
+		t.Errorf("got %+v", c)
+	}
+}
@@ -0,0 +1,139 @@
+package reglib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// listResponse is the page of the catalog or the tags list
+type listResponse struct {
+	Repositories []string `json:"repositories"`
+	Tags         []string `json:"tags"`
+}
+
+// pager gets the pages of the paginated list, e.g. /v2/_catalog, one by
+// one. The next page is the one of the Link header if the registry
+// responds it, otherwise it's requested with the last name of the page
+// if the page is full and the registry never responds the Link header.
+// The retryable errors are retried by the transport already, so any
+// error stops the listing
+type pager struct {
+	c *Client
+	// the url of the next page, it's empty if there are no more pages
+	next string
+	// linked is true if the registry responds the Link header
+	linked bool
+}
+
+// newPager returns the pager of the list, it starts after the last if
+// it's not empty
+func (c *Client) newPager(path, last string) *pager {
+	q := url.Values{}
+	q.Set("n", strconv.Itoa(c.pageSize))
+	if last != "" {
+		q.Set("last", last)
+	}
+	return &pager{c: c, next: c.baseURL + path + "?" + q.Encode()}
+}
+
+// page gets the next page, it returns io.EOF if there are no more pages
+func (p *pager) page(ctx context.Context) ([]string, error) {
+	if p.next == "" {
+		return nil, io.EOF
+	}
+	u := p.next
+	names, next, err := p.c.listPage(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if next != "" {
+		p.linked = true
+	} else if !p.linked && len(names) > 0 && len(names) == p.c.pageSize {
+		// the page may not be the last one
+		next = lastURL(u, names[len(names)-1])
+	}
+	if next == u {
+		return nil, fmt.Errorf("list %s error: the next page is the same page", u)
+	}
+	p.next = next
+	return names, nil
+}
+
+// listPage gets a page of the list, and returns the url of the next
+// page by the Link header
+func (c *Client) listPage(ctx context.Context, u string) (names []string, next string, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", newRegistryError(resp)
+	}
+
+	page := listResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, "", fmt.Errorf("decode %s error: %w", u, err)
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<20))
+	names = append(page.Repositories, page.Tags...)
+
+	next, err = nextLink(req.URL, resp.Header)
+	return names, next, err
+}
+
+// lastURL returns the url with the "last" parameter
+func lastURL(u, last string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	q := parsed.Query()
+	q.Set("last", last)
+	parsed.RawQuery = q.Encode()
+	return parsed.String()
+}
+
+// nextLink returns the url of the next page by the Link header, see
+// https://tools.ietf.org/html/rfc5988, the relative url is resolved
+// against the url of the request
+func nextLink(base *url.URL, header http.Header) (string, error) {
+	for _, value := range header["Link"] {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "rel") {
+					continue
+				}
+				// rel may have several space-separated types
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(kv[1]), `"`)) {
+					if !strings.EqualFold(rel, "next") {
+						continue
+					}
+					u, err := base.Parse(strings.TrimSpace(target[1 : len(target)-1]))
+					if err != nil {
+						return "", fmt.Errorf("invalid Link header %q: %w", value, err)
+					}
+					return u.String(), nil
+				}
+			}
+		}
+	}
+	return "", nil
+}
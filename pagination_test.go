@@ -0,0 +1,183 @@
+package reglib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNextLink(t *testing.T) {
+	base, _ := url.Parse("https://r.kfd.me/v2/_catalog?n=2")
+	for _, c := range []struct{ link, want string }{
+		{"", ""},
+		{`</v2/_catalog?last=b&n=2>; rel="next"`, "https://r.kfd.me/v2/_catalog?last=b&n=2"},
+		{`<https://cdn.kfd.me/v2/_catalog?cursor=x>; rel=next`, "https://cdn.kfd.me/v2/_catalog?cursor=x"},
+		{`</v2/_catalog?n=2>; rel="prev", </v2/_catalog?last=d>; rel="next"`, "https://r.kfd.me/v2/_catalog?last=d"},
+		{`</v2/_catalog?last=d>; title="x"; rel="last next"`, "https://r.kfd.me/v2/_catalog?last=d"},
+		{`</v2/_catalog?n=2>; rel="prev"`, ""},
+	} {
+		header := http.Header{}
+		if c.link != "" {
+			header.Set("Link", c.link)
+		}
+		got, err := nextLink(base, header)
+		if err != nil {
+			t.Errorf("%s: %s", c.link, err)
+		}
+		if got != c.want {
+			t.Errorf("%s: got %q, want %q", c.link, got, c.want)
+		}
+	}
+}
+
+func TestCatalogLinkPagination(t *testing.T) {
+	repos := []string{"a", "b", "c", "d", "e"}
+	var pages int32
+	// the pages are linked by the opaque cursors instead of "last"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/_catalog" {
+			return
+		}
+		atomic.AddInt32(&pages, 1)
+		if r.URL.Query().Get("last") != "" {
+			t.Errorf("unexpected last in %s", r.URL)
+		}
+		cursor, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		end := cursor + n
+		if end < len(repos) {
+			w.Header().Set("Link", `</v2/_catalog?n=`+strconv.Itoa(n)+
+				`&cursor=`+strconv.Itoa(end)+`>; rel="next"`)
+		} else {
+			end = len(repos)
+		}
+		json.NewEncoder(w).Encode(map[string][]string{"repositories": repos[cursor:end]})
+	}))
+	defer ts.Close()
+
+	r, err := New(ts.URL, WithPageSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := listRepoNames(t, r, nil)
+	if !reflect.DeepEqual(got, repos) {
+		t.Errorf("got %v, want %v", got, repos)
+	}
+	if n := atomic.LoadInt32(&pages); n != 3 {
+		t.Errorf("got %d pages, want 3", n)
+	}
+}
+
+func TestCatalogPaginationWithoutLink(t *testing.T) {
+	catalog := newPagedCatalog("a", "b", "c", "d")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// drop the Link header
+		catalog.ServeHTTP(noLinkWriter{w}, r)
+	}))
+	defer ts.Close()
+
+	r, err := New(ts.URL, WithPageSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := listRepoNames(t, r, nil)
+	if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// the third page is empty
+	if n := atomic.LoadInt32(&catalog.pages); n != 3 {
+		t.Errorf("got %d pages, want 3", n)
+	}
+}
+
+type noLinkWriter struct {
+	http.ResponseWriter
+}
+
+func (w noLinkWriter) WriteHeader(status int) {
+	w.Header().Del("Link")
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w noLinkWriter) Write(b []byte) (int, error) {
+	w.Header().Del("Link")
+	return w.ResponseWriter.Write(b)
+}
+
+func TestCatalogPaginationError(t *testing.T) {
+	var pages int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/_catalog" {
+			return
+		}
+		if atomic.AddInt32(&pages, 1) > 1 {
+			writeRegistryError(w, http.StatusInternalServerError, "UNKNOWN", "boom")
+			return
+		}
+		w.Header().Set("Link", `</v2/_catalog?last=a&n=1>; rel="next"`)
+		json.NewEncoder(w).Encode(map[string][]string{"repositories": {"a"}})
+	}))
+	defer ts.Close()
+
+	r, err := New(ts.URL, WithPageSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos, err := r.Repos(context.Background(), nil)
+	var re *RegistryError
+	if !errors.As(err, &re) || re.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("got error %v", err)
+	}
+	if len(repos) != 1 {
+		t.Errorf("got %d repos before the error", len(repos))
+	}
+	if n := atomic.LoadInt32(&pages); n != 2 {
+		t.Errorf("got %d pages, want 2", n)
+	}
+}
+
+func TestTagsLinkPagination(t *testing.T) {
+	tags := []string{"1.0", "1.1", "2.0"}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/alpine/tags/list" {
+			return
+		}
+		i := 0
+		if last := r.URL.Query().Get("last"); last != "" {
+			for tags[i] != last {
+				i++
+			}
+			i++
+		}
+		page := tags[i:]
+		if len(page) > 2 {
+			page = page[:2]
+			w.Header().Set("Link", `</v2/alpine/tags/list?n=2&last=`+page[1]+`>; rel="next"`)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": "alpine", "tags": page})
+	}))
+	defer ts.Close()
+
+	r, err := New(ts.URL, WithPageSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Tags(context.Background(), "alpine", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, tag := range got {
+		names = append(names, tag.Name)
+	}
+	if !reflect.DeepEqual(names, tags) {
+		t.Errorf("got %v, want %v", names, tags)
+	}
+}
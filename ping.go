@@ -0,0 +1,168 @@
+package reglib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// the repository and the digest to probe the features, they don't
+// exist, and the probes are read-only requests
+const (
+	pingRepo   = "reglib/ping"
+	pingDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+)
+
+// Support tells whether the registry supports a feature
+type Support int
+
+const (
+	// SupportUnknown means it's not discovered, e.g. the probe is denied
+	SupportUnknown Support = iota
+	Supported
+	Unsupported
+)
+
+func (s Support) String() string {
+	switch s {
+	case Supported:
+		return "supported"
+	case Unsupported:
+		return "unsupported"
+	}
+	return "unknown"
+}
+
+// Capabilities are the features of the registry discovered by Ping
+type Capabilities struct {
+	// APIVersion is the Docker-Distribution-API-Version of the
+	// registry, e.g. "registry/2.0", it's empty if not reported
+	APIVersion string
+	// AuthScheme is the scheme the registry challenged, "bearer" or
+	// "basic", it's empty if the registry is anonymous
+	AuthScheme string
+	// Catalog tells whether the registry serves the catalog, it's unknown
+	// if the catalog is denied for the credential
+	Catalog Support
+	// Referrers is the OCI referrers API
+	Referrers Support
+	// RangeRequests tells whether the blobs can be downloaded in ranges,
+	// it's discovered by downloading a blob
+	RangeRequests Support
+	// CrossRepoMount can't be discovered without pushing, it's unknown
+	CrossRepoMount Support
+	// Delete can't be discovered without a DELETE request, which may be
+	// audited as a delete attempt, so Ping leaves it unknown
+	Delete Support
+}
+
+// Ping checks the registry is a v2 registry and discovers its
+// capabilities by the read-only requests, the capabilities are cached
+// for the other operations, e.g. Repos fails early if the catalog is
+// unsupported
+func (c *Client) Ping(ctx context.Context) (caps Capabilities, err error) {
+	ctx, span := c.startSpan(ctx, "reglib.Ping")
+	defer func() { endSpan(span, err) }()
+
+	header, err := c.probe(ctx, "GET", "/v2/")
+	if header != nil {
+		caps.APIVersion = header.Get("Docker-Distribution-API-Version")
+	}
+	caps.AuthScheme = c.author.scheme(c.Host())
+	if err != nil {
+		var re *RegistryError
+		if errors.As(err, &re) && caps.APIVersion == "" {
+			err = fmt.Errorf("%s is not a v2 registry: %w", c.Host(), err)
+		}
+		return caps, fmt.Errorf("ping %s error: %w", c.Host(), err)
+	}
+
+	// the denial is for the current credential, which may be rotated,
+	// it doesn't mean the catalog is missing
+	_, err = c.probe(ctx, "GET", "/v2/_catalog?n=1")
+	switch {
+	case err == nil:
+		caps.Catalog = Supported
+	case errors.Is(err, ErrUnauthorized), errors.Is(err, ErrDenied):
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrUnsupported):
+		caps.Catalog = Unsupported
+	}
+
+	// the registries without the API respond the plain 404 of the router,
+	// while the ones with it say the repository or manifest is unknown
+	_, err = c.probe(ctx, "GET", "/v2/"+pingRepo+"/referrers/"+pingDigest)
+	var re *RegistryError
+	switch {
+	case err == nil:
+		caps.Referrers = Supported
+	case errors.As(err, &re) && re.StatusCode == http.StatusNotFound:
+		caps.Referrers = Unsupported
+		if re.hasCode("NAME_UNKNOWN", "MANIFEST_UNKNOWN", "NOT_FOUND") {
+			caps.Referrers = Supported
+		}
+	}
+
+	c.capsMutex.Lock()
+	if c.caps != nil {
+		caps.RangeRequests = c.caps.RangeRequests
+	}
+	c.caps = &caps
+	c.capsMutex.Unlock()
+	return caps, nil
+}
+
+// probe sends the request and returns the header of the response, the
+// error is a *RegistryError if the registry responds an error
+func (c *Client) probe(ctx context.Context, method, path string) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp.Header, newRegistryError(resp)
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<20))
+	return resp.Header, nil
+}
+
+// capabilities returns the cached capabilities, ok is false if the
+// registry is not pinged
+func (c *Client) capabilities() (caps Capabilities, ok bool) {
+	c.capsMutex.RLock()
+	defer c.capsMutex.RUnlock()
+	if c.caps == nil {
+		return caps, false
+	}
+	return *c.caps, true
+}
+
+// setRangeSupport records whether the registry supports the range requests
+func (c *Client) setRangeSupport(s Support) {
+	c.capsMutex.Lock()
+	defer c.capsMutex.Unlock()
+	if c.caps == nil {
+		c.caps = &Capabilities{}
+	}
+	c.caps.RangeRequests = s
+}
+
+// rangeSupport returns the support of the range requests by the
+// Accept-Ranges header of the blob
+func rangeSupport(header http.Header) Support {
+	switch strings.ToLower(header.Get("Accept-Ranges")) {
+	case "bytes":
+		return Supported
+	case "none":
+		return Unsupported
+	}
+	return SupportUnknown
+}
@@ -0,0 +1,191 @@
+package reglib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// distributionHandler acts like a distribution registry with the
+// deletes disabled
+func distributionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+	switch {
+	case r.URL.Path == "/v2/":
+		w.Write([]byte("{}"))
+	case r.URL.Path == "/v2/_catalog":
+		catalogHandler(w, r)
+	case r.Method == "DELETE":
+		writeRegistryError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "The operation is unsupported.")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestPing(t *testing.T) {
+	var writes int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			atomic.AddInt32(&writes, 1)
+		}
+		distributionHandler(w, r)
+	}))
+	defer ts.Close()
+
+	r, err := New(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps, err := r.Ping(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := Capabilities{
+		APIVersion: "registry/2.0",
+		Catalog:    Supported,
+		Referrers:  Unsupported,
+	}
+	if caps != expect {
+		t.Errorf("expect %+v, got %+v", expect, caps)
+	}
+	if n := atomic.LoadInt32(&writes); n != 0 {
+		t.Errorf("got %d write requests", n)
+	}
+}
+
+func TestPingBearer(t *testing.T) {
+	registry, tokenServer := newTokenRegistry(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"token":"valid"}`))
+	})
+	defer registry.Close()
+	defer tokenServer.Close()
+
+	r, err := New(registry.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps, err := r.Ping(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.AuthScheme != "bearer" || caps.Catalog != Supported ||
+		caps.Referrers != Supported || caps.Delete != SupportUnknown {
+		t.Errorf("bad capabilities %+v", caps)
+	}
+}
+
+func TestPingNotRegistry(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	r, err := New(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Ping(context.Background()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expect not found, got %v", err)
+	}
+}
+
+func TestCatalogUnsupported(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/_catalog" {
+			writeRegistryError(w, http.StatusNotFound, "UNSUPPORTED", "catalog is disabled")
+			return
+		}
+		distributionHandler(w, r)
+	}))
+	defer ts.Close()
+
+	r, err := New(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps, err := r.Ping(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.Catalog != Unsupported {
+		t.Errorf("expect the catalog unsupported, got %s", caps.Catalog)
+	}
+	if _, err := r.Repos(context.Background(), nil); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expect unsupported, got %v", err)
+	}
+}
+
+func TestCatalogDenied(t *testing.T) {
+	var denied int32 = 1
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/_catalog" && atomic.LoadInt32(&denied) == 1 {
+			writeRegistryError(w, http.StatusForbidden, "DENIED", "requested access to the resource is denied")
+			return
+		}
+		distributionHandler(w, r)
+	}))
+	defer ts.Close()
+
+	r, err := New(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps, err := r.Ping(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.Catalog != SupportUnknown {
+		t.Errorf("expect the catalog unknown, got %s", caps.Catalog)
+	}
+	// e.g. the credential is rotated
+	atomic.StoreInt32(&denied, 0)
+	if _, err := r.Repos(context.Background(), nil); err != nil {
+		t.Errorf("list repos error: %s", err)
+	}
+}
+
+func TestDownloadRangeIgnored(t *testing.T) {
+	blob := bytes.Repeat([]byte("0123456789"), fixedSize/10+fixedSize/20)
+	var gets int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// respond the whole blob to any range
+		w.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+		if r.Method == "GET" {
+			atomic.AddInt32(&gets, 1)
+			w.Write(blob)
+		}
+	}))
+	defer ts.Close()
+
+	r, err := New(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := r.(*Client)
+	target := t.TempDir() + "/blob"
+	if err := c.downloadBlob(context.Background(), "alpine", "sha256:abc", target); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, blob) {
+		t.Errorf("bad blob, expect %d bytes, got %d", len(blob), len(got))
+	}
+	if caps, _ := c.capabilities(); caps.RangeRequests != Unsupported {
+		t.Errorf("expect the ranges unsupported, got %s", caps.RangeRequests)
+	}
+
+	atomic.StoreInt32(&gets, 0)
+	if err := c.downloadBlob(context.Background(), "alpine", "sha256:abc", target); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&gets); n != 1 {
+		t.Errorf("expect 1 request without ranges, got %d", n)
+	}
+}
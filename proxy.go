@@ -0,0 +1,181 @@
+package reglib
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ProxyConfig configures the proxies of the client like the proxy
+// environment variables, the proxies can be HTTP(S) or SOCKS5 URLs
+type ProxyConfig struct {
+	// HTTPProxy is the proxy of the plain HTTP registries
+	HTTPProxy string
+	// HTTPSProxy is the proxy of the HTTPS registries
+	HTTPSProxy string
+	// NoProxy is a comma separated list of the hosts not to proxy, an
+	// entry is "*", an IP, a CIDR, or a domain with an optional port,
+	// the domain "example.com" matches itself and its subdomains while
+	// ".example.com" matches the subdomains only
+	NoProxy string
+}
+
+// ProxyFromEnvironment returns the proxy config of HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY (or the lowercase ones), the loopback
+// addresses are never proxied like the Go programs do
+func ProxyFromEnvironment() ProxyConfig {
+	noProxy := "localhost,127.0.0.0/8,::1/128"
+	if v := getenv("NO_PROXY", "no_proxy"); v != "" {
+		noProxy += "," + v
+	}
+	return ProxyConfig{
+		HTTPProxy:  getenv("HTTP_PROXY", "http_proxy"),
+		HTTPSProxy: getenv("HTTPS_PROXY", "https_proxy"),
+		NoProxy:    noProxy,
+	}
+}
+
+func getenv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// proxyFunc returns the function of the http.Transport's Proxy
+func (p ProxyConfig) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	httpProxy, err := parseProxy(p.HTTPProxy)
+	if err != nil {
+		return nil, err
+	}
+	httpsProxy, err := parseProxy(p.HTTPSProxy)
+	if err != nil {
+		return nil, err
+	}
+	if httpProxy == nil && httpsProxy == nil {
+		return nil, nil
+	}
+	noProxy := parseNoProxy(p.NoProxy)
+
+	return func(req *http.Request) (*url.URL, error) {
+		proxy := httpsProxy
+		if req.URL.Scheme == "http" {
+			proxy = httpProxy
+		}
+		if proxy == nil || noProxy.match(req.URL) {
+			return nil, nil
+		}
+		return proxy, nil
+	}, nil
+}
+
+func parseProxy(proxy string) (*url.URL, error) {
+	if proxy == "" {
+		return nil, nil
+	}
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("bad proxy %s: %s", proxy, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("bad proxy %s: unsupported scheme %s", proxy, u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("bad proxy %s: no host", proxy)
+	}
+	return u, nil
+}
+
+// noProxyDomain is a domain entry of the no_proxy, the port is
+// optional, the domain itself matches unless it starts with "."
+type noProxyDomain struct {
+	domain  string
+	port    string
+	subOnly bool
+}
+
+type noProxyList struct {
+	all     bool
+	nets    []*net.IPNet
+	domains []noProxyDomain
+}
+
+func parseNoProxy(value string) noProxyList {
+	var l noProxyList
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			l.all = true
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			l.nets = append(l.nets, ipNet)
+			continue
+		}
+
+		host, port := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			host, port = h, p
+		}
+		if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			l.nets = append(l.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		d := noProxyDomain{port: port}
+		if strings.HasPrefix(host, "*.") {
+			host = host[1:]
+		}
+		d.subOnly = strings.HasPrefix(host, ".")
+		d.domain = strings.TrimPrefix(host, ".")
+		l.domains = append(l.domains, d)
+	}
+	return l
+}
+
+// match reports whether the URL is not to proxy
+func (l noProxyList) match(u *url.URL) bool {
+	if l.all {
+		return true
+	}
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		for _, ipNet := range l.nets {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, d := range l.domains {
+		if d.port != "" && d.port != port {
+			continue
+		}
+		if strings.HasSuffix(host, "."+d.domain) || (!d.subOnly && host == d.domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package reglib
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+// proxyStub is an HTTP forward proxy which serves the registry of
+// the host "registry.test" itself
+func proxyStub(proxied *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(proxied, 1)
+		if r.URL.Host != "registry.test" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		catalogHandler(w, r)
+	}))
+}
+
+// socks5Stub is a SOCKS5 proxy without auth which connects the
+// host "registry.test" to the target
+func socks5Stub(t *testing.T, target string, proxied *int32) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				// greeting: VER NMETHODS METHODS
+				buf := make([]byte, 262)
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+					return
+				}
+				conn.Write([]byte{5, 0})
+				// request: VER CMD RSV ATYP(3) LEN HOST PORT
+				if _, err := io.ReadFull(conn, buf[:5]); err != nil || buf[3] != 3 {
+					return
+				}
+				hostPort := make([]byte, int(buf[4])+2)
+				if _, err := io.ReadFull(conn, hostPort); err != nil {
+					return
+				}
+				host := string(hostPort[:len(hostPort)-2])
+				port := binary.BigEndian.Uint16(hostPort[len(hostPort)-2:])
+				if host != "registry.test" || port != 80 {
+					conn.Write([]byte{5, 4, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				atomic.AddInt32(proxied, 1)
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				go io.Copy(upstream, conn)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestHTTPProxy(t *testing.T) {
+	var proxied int32
+	proxy := proxyStub(&proxied)
+	defer proxy.Close()
+
+	if err := getCatalog("http://registry.test", WithProxy(proxy.URL)); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&proxied) == 0 {
+		t.Error("the request is not proxied")
+	}
+
+	t.Setenv("HTTP_PROXY", proxy.URL)
+	t.Setenv("NO_PROXY", "")
+	atomic.StoreInt32(&proxied, 0)
+	if err := getCatalog("http://registry.test"); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&proxied) == 0 {
+		t.Error("the environment proxy is not used")
+	}
+
+	// the registry is excluded by the no_proxy, and the proxy is not used
+	registry := httptest.NewServer(http.HandlerFunc(catalogHandler))
+	defer registry.Close()
+	u, _ := url.Parse(registry.URL)
+	atomic.StoreInt32(&proxied, 0)
+	err := getCatalog(registry.URL, WithProxyConfig(ProxyConfig{
+		HTTPProxy: proxy.URL,
+		NoProxy:   "example.com, " + u.Hostname(),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&proxied) != 0 {
+		t.Error("the no_proxy host is proxied")
+	}
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+	registry := httptest.NewServer(http.HandlerFunc(catalogHandler))
+	defer registry.Close()
+	u, _ := url.Parse(registry.URL)
+
+	var proxied int32
+	addr := socks5Stub(t, u.Host, &proxied)
+	if err := getCatalog("http://registry.test", WithProxy("socks5://"+addr)); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&proxied) != 1 {
+		t.Error("the request is not proxied")
+	}
+}
+
+func TestNoProxy(t *testing.T) {
+	l := parseNoProxy("example.com, .sub.io, *.wild.io, internal:5000, 10.0.0.0/8, 192.168.1.1, ::1")
+	for u, expect := range map[string]bool{
+		"https://example.com":    true,
+		"https://a.example.com":  true,
+		"https://badexample.com": false,
+		"https://sub.io":         false,
+		"https://a.sub.io":       true,
+		"https://wild.io":        false,
+		"https://a.wild.io":      true,
+		"https://internal:5000":  true,
+		"https://internal":       false,
+		"https://10.1.2.3:5000":  true,
+		"https://192.168.1.1":    true,
+		"https://192.168.1.2":    false,
+		"http://[::1]:5000":      true,
+		"https://EXAMPLE.com":    true,
+		"https://docker.io":      false,
+	} {
+		parsed, _ := url.Parse(u)
+		if got := l.match(parsed); got != expect {
+			t.Errorf("%s: expect %v, got %v", u, expect, got)
+		}
+	}
+	if !parseNoProxy("*").match(&url.URL{Scheme: "https", Host: "any"}) {
+		t.Error("* should match all")
+	}
+
+	for _, proxy := range []string{"ftp://proxy", "http://"} {
+		if _, err := (ProxyConfig{HTTPSProxy: proxy}).proxyFunc(); err == nil {
+			t.Errorf("%s: expect error", proxy)
+		}
+	}
+}
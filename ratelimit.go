@@ -0,0 +1,163 @@
+package reglib
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// tokenBucket allows rate events per second with bursts of burst
+type tokenBucket struct {
+	m      sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token and returns how long to wait for it
+func (b *tokenBucket) reserve() time.Duration {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel gives back the token which is not used
+func (b *tokenBucket) cancel() {
+	b.m.Lock()
+	b.tokens++
+	b.m.Unlock()
+}
+
+func (b *tokenBucket) wait(ctx context.Context) error {
+	d := b.reserve()
+	if d == 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// limitTransport limits the requests rate of every host and the
+// requests in flight of all the hosts, a request takes a slot of the
+// concurrency until its response body is closed
+type limitTransport struct {
+	next  http.RoundTripper
+	rate  float64
+	burst int
+	slots chan struct{}
+
+	m     sync.Mutex
+	hosts map[string]*tokenBucket
+}
+
+func newLimitTransport(next http.RoundTripper, rate float64, burst, concurrency int) http.RoundTripper {
+	if rate <= 0 && concurrency <= 0 {
+		return next
+	}
+	t := &limitTransport{
+		next:  next,
+		rate:  rate,
+		burst: burst,
+		hosts: make(map[string]*tokenBucket),
+	}
+	if concurrency > 0 {
+		t.slots = make(chan struct{}, concurrency)
+	}
+	return t
+}
+
+func (t *limitTransport) bucket(host string) *tokenBucket {
+	t.m.Lock()
+	defer t.m.Unlock()
+	b, ok := t.hosts[host]
+	if !ok {
+		b = newTokenBucket(t.rate, t.burst)
+		t.hosts[host] = b
+	}
+	return b
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if t.slots != nil {
+		select {
+		case t.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if t.slots != nil {
+			<-t.slots
+		}
+	}
+
+	if t.rate > 0 {
+		if err := t.bucket(req.URL.Host).wait(ctx); err != nil {
+			release()
+			return nil, err
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return resp, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releaseBody releases the slot once the body is read or closed
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.release)
+	}
+	return n, err
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,66 @@
+package reglib
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(catalogHandler))
+	defer ts.Close()
+
+	r, err := New(ts.URL, WithInsecureRegistries(), WithRateLimit(10, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := catalogOf(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first one is free, the others wait 100ms each
+	if used := time.Since(start); used < 250*time.Millisecond {
+		t.Errorf("requests are not limited, used %s", used)
+	}
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	var inFlight, max int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		catalogHandler(w, r)
+	}))
+	defer ts.Close()
+
+	r, err := New(ts.URL, WithInsecureRegistries(), WithMaxConcurrency(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := catalogOf(r); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := atomic.LoadInt32(&max); got > 2 {
+		t.Errorf("expect at most 2 requests in flight, got %d", got)
+	}
+}
@@ -0,0 +1,115 @@
+package reglib
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+)
+
+// Reference is a parsed image reference like "alpine",
+// "library/alpine:3.19" or "ghcr.io/org/app@sha256:..."
+type Reference struct {
+	// Host is the registry host, "docker.io" for the docker hub
+	Host string
+	// Repository is the path of the repository in the registry, the
+	// official images of the docker hub are prefixed with "library/"
+	Repository string
+	// Tag and Digest are empty if not given
+	Tag    string
+	Digest string
+}
+
+// ParseReference parses the image reference, the references without
+// a registry host are of the docker hub, e.g. "alpine:3.19" is parsed
+// as docker.io/library/alpine:3.19, the tag is not defaulted to latest
+func ParseReference(s string) (Reference, error) {
+	named, err := reference.ParseNormalizedNamed(s)
+	if err != nil {
+		return Reference{}, fmt.Errorf("parse reference %q error: %s", s, err)
+	}
+	ref := Reference{
+		Host:       reference.Domain(named),
+		Repository: reference.Path(named),
+	}
+	if tagged, ok := named.(reference.Tagged); ok {
+		ref.Tag = tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		ref.Digest = digested.Digest().String()
+	}
+	return ref, nil
+}
+
+// Name returns the host and the repository, e.g. docker.io/library/alpine
+func (r Reference) Name() string {
+	return r.Host + "/" + r.Repository
+}
+
+// String returns the full reference, e.g. docker.io/library/alpine:3.19
+func (r Reference) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// hasDomain reports whether the reference starts with a registry host,
+// by the same rules as the docker cli
+func hasDomain(s string) bool {
+	i := strings.IndexRune(s, '/')
+	if i < 0 {
+		return false
+	}
+	domain := s[:i]
+	return strings.ContainsAny(domain, ".:") || domain == "localhost" ||
+		strings.ToLower(domain) != domain
+}
+
+// reference parses the reference of an image in the registry of the
+// client, the reference may omit the host, it's normalized as the docker
+// hub's only if the client is of the docker hub. The first component of
+// the reference which looks like a host but isn't the client's, e.g. the
+// namespace "my.team" of "my.team/app", is a part of the repository path,
+// except for the docker hub whose namespaces can't have "." or ":"
+func (c *Client) reference(s string) (Reference, error) {
+	ref, err := ParseReference(s)
+	if err != nil {
+		return ref, err
+	}
+
+	if hasDomain(s) {
+		if ref.Host == c.Host() ||
+			(isDockerHub(ref.Host) && isDockerHub(c.Host())) {
+			ref.Host = c.Host()
+			return ref, nil
+		}
+		ref.Repository = referencePath(s)
+		// it's of another registry if it can't be a path of the client's,
+		// the paths can't have a port or upper case letters
+		if isDockerHub(c.Host()) || strings.ContainsRune(ref.Repository, ':') ||
+			strings.ToLower(ref.Repository) != ref.Repository {
+			return ref, fmt.Errorf("reference %s is not of the registry %s", s, c.Host())
+		}
+	} else if !isDockerHub(c.Host()) {
+		// keep the path as is, e.g. "alpine" instead of "library/alpine"
+		ref.Repository = referencePath(s)
+	}
+	ref.Host = c.Host()
+	return ref, nil
+}
+
+// referencePath returns the reference without the tag and the digest
+func referencePath(s string) string {
+	if i := strings.IndexRune(s, '@'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.LastIndex(s, ":"); i > strings.LastIndex(s, "/") {
+		s = s[:i]
+	}
+	return s
+}
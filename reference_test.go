@@ -0,0 +1,126 @@
+package reglib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testDigest = "sha256:4bf1f9a4f3b2f7a1e9c0c0d6a2b9d9d0c5e2a4b6d8f0a1c3e5b7d9f1a3c5e7b9"
+
+func TestParseReference(t *testing.T) {
+	for s, expect := range map[string]Reference{
+		"alpine":                           {"docker.io", "library/alpine", "", ""},
+		"library/alpine:3.19":              {"docker.io", "library/alpine", "3.19", ""},
+		"docker.io/org/app":                {"docker.io", "org/app", "", ""},
+		"host:5000/repo":                   {"host:5000", "repo", "", ""},
+		"host:5000/a/b:v1":                 {"host:5000", "a/b", "v1", ""},
+		"localhost/app":                    {"localhost", "app", "", ""},
+		"ghcr.io/org/app@" + testDigest:    {"ghcr.io", "org/app", "", testDigest},
+		"ghcr.io/org/app:v1@" + testDigest: {"ghcr.io", "org/app", "v1", testDigest},
+	} {
+		ref, err := ParseReference(s)
+		if err != nil {
+			t.Errorf("%s: %s", s, err)
+			continue
+		}
+		if ref != expect {
+			t.Errorf("%s: expect %+v, got %+v", s, expect, ref)
+		}
+	}
+
+	for _, s := range []string{"", "Alpine", "alpine:", "alpine@sha256:xyz"} {
+		if _, err := ParseReference(s); err == nil {
+			t.Errorf("%q: expect error", s)
+		}
+	}
+
+	ref, _ := ParseReference("alpine:3.19@" + testDigest)
+	if ref.String() != "docker.io/library/alpine:3.19@"+testDigest {
+		t.Errorf("bad string %s", ref)
+	}
+}
+
+func TestClientReference(t *testing.T) {
+	hub := &Client{baseURL: "https://registry-1.docker.io"}
+	private := &Client{baseURL: "host:5000"}
+	for _, c := range []*Client{hub, private} {
+		if err := c.init(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		c    *Client
+		s    string
+		repo string
+		err  bool
+	}{
+		{hub, "alpine:3.19", "library/alpine", false},
+		{hub, "docker.io/org/app", "org/app", false},
+		{hub, "ghcr.io/org/app", "", true},
+		{private, "alpine:3.19", "alpine", false},
+		{private, "library/alpine@" + testDigest, "library/alpine", false},
+		{private, "host:5000/a/b:v1", "a/b", false},
+		{private, "my.team/app:v1", "my.team/app", false},
+		{private, "localhost/app@" + testDigest, "localhost/app", false},
+		{private, "other:5000/a/b", "", true},
+		{private, "Other/app", "", true},
+	} {
+		ref, err := tc.c.reference(tc.s)
+		if (err != nil) != tc.err {
+			t.Errorf("%s: unexpected error %v", tc.s, err)
+			continue
+		}
+		if !tc.err && (ref.Repository != tc.repo || ref.Host != tc.c.Host()) {
+			t.Errorf("%s: expect %s, got %+v", tc.s, tc.repo, ref)
+		}
+	}
+}
+
+func TestImageByDigest(t *testing.T) {
+	manifest := `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json",` +
+		`"config":{"mediaType":"application/vnd.docker.container.image.v1+json","size":1,"digest":"` + testDigest + `"},` +
+		`"layers":[{"mediaType":"application/vnd.docker.image.rootfs.diff.tar.gzip","size":2,"digest":"` + testDigest + `"}]}`
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path != "/v2/org/app/manifests/"+testDigest {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+		w.Write([]byte(manifest))
+	}))
+	defer ts.Close()
+
+	r, err := New(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := r.Image(context.Background(), "org/app@"+testDigest, "")
+	if err != nil {
+		t.Fatalf("%s, requested %v", err, paths)
+	}
+	if img.V1 != nil || len(img.Layers()) != 1 {
+		t.Errorf("bad image %+v", img)
+	}
+	if img.FullName() != "org/app@"+testDigest {
+		t.Errorf("bad name %s", img.FullName())
+	}
+
+	// the tag and the digest are not mixed
+	paths = nil
+	for _, c := range [][2]string{
+		{"org/app:v1@" + testDigest, ""},
+		{"org/app@" + testDigest, "v1"},
+	} {
+		if _, err := r.Image(context.Background(), c[0], c[1]); err == nil {
+			t.Errorf("%s with tag %q: expect error", c[0], c[1])
+		}
+	}
+	if len(paths) != 0 {
+		t.Errorf("requested %v", paths)
+	}
+}
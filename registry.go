@@ -9,22 +9,44 @@ import (
 type Registry interface {
 	// Repos list the repositories
 	Repos(ctx context.Context, opts *ListRepoOptions) ([]Repository, error)
-	// ReposChan returns a channel contains the repos
+	// ReposChan returns a channel contains the repos, cancel the ctx to
+	// abandon the channel
 	ReposChan(ctx context.Context, opts *ListRepoOptions) (chan Repository, error)
+	// IterRepos returns the iterator of the repositories
+	IterRepos(ctx context.Context, opts *ListRepoOptions) (*RepoIterator, error)
 	// Tags list the tags of the repository
 	Tags(ctx context.Context, repo string, opts *ListTagOptions) ([]Tag, error)
-	// Image get the image instance via the specific repo and tag
+	// IterTags returns the iterator of the tags of the repository
+	IterTags(ctx context.Context, repo string, opts *ListTagOptions) (*TagIterator, error)
+	// Image get the image instance via the specific repo and tag, the
+	// repo can be an image reference
 	Image(ctx context.Context, repo, tag string) (*Image, error)
+	// Download the image of the reference to the target
+	Download(ctx context.Context, ref, target string) error
+	// Ping checks the registry and discovers its capabilities
+	Ping(ctx context.Context) (Capabilities, error)
 	// return the registry's host (domain)
 	Host() string
 }
 
-// New docker registry client
-func New(baseURL, user, pass string) (Registry, error) {
+// New docker registry client, it's anonymous unless the credentials
+// are given by the options
+func New(baseURL string, opts ...Option) (Registry, error) {
 	c := &Client{
 		baseURL:  baseURL,
-		username: user,
-		password: pass,
+		certsDir: defaultCertsDir,
+
+		insecureRegistries: defaultInsecureRegistries,
+		timeout:            defaultTimeout,
+		loadTimeout:        defaultLoadTimeout,
+		userAgent:          defaultUserAgent,
+		pageSize:           defaultPageSize,
+		maxConnsPerHost:    defaultMaxConnsPerHost,
+		retryPolicy:        DefaultRetryPolicy,
+		maxConcurrency:     defaultMaxConcurrency,
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
 
 	if err := c.init(); err != nil {
@@ -34,8 +56,19 @@ func New(baseURL, user, pass string) (Registry, error) {
 	return c, nil
 }
 
-// NewFromConfigFile ...
-func NewFromConfigFile(baseURL string) (Registry, error) {
-	username, password := GetAuthFromFile(baseURL)
-	return New(baseURL, username, password)
+// NewWithAuth creates the client with the username and password
+func NewWithAuth(baseURL, user, pass string, opts ...Option) (Registry, error) {
+	return New(baseURL, append([]Option{WithBasicAuth(user, pass)}, opts...)...)
+}
+
+// NewWithCredentials creates the client which asks the creds for the
+// credential every time it authenticates against the registry
+func NewWithCredentials(baseURL string, creds Credentials, opts ...Option) (Registry, error) {
+	return New(baseURL, append([]Option{WithCredentials(creds)}, opts...)...)
+}
+
+// NewFromConfigFile creates the client with the credentials from
+// $HOME/.docker/config.json, see DockerConfigCredentials
+func NewFromConfigFile(baseURL string, opts ...Option) (Registry, error) {
+	return NewWithCredentials(baseURL, DockerConfigCredentials(), opts...)
 }
@@ -0,0 +1,171 @@
+package reglib
+
+import (
+	"context"
+	"sync"
+)
+
+// the API endpoint of the docker hub
+const dockerHubEndpoint = "registry-1.docker.io"
+
+// Resolver routes the image references to the clients of their
+// registries, the clients are created on the first use and cached
+type Resolver struct {
+	opts     []Option
+	hostOpts map[string][]Option
+
+	m       sync.Mutex
+	clients map[string]*Client
+}
+
+// ResolverOption configures the Resolver
+type ResolverOption func(*Resolver)
+
+// WithClientOptions appends the options of all the clients, the clients
+// use the credentials of the docker config by default
+func WithClientOptions(opts ...Option) ResolverOption {
+	return func(r *Resolver) {
+		r.opts = append(r.opts, opts...)
+	}
+}
+
+// WithHostOptions appends the options of the client of the registry
+// host, they are applied after the ones of all the clients
+func WithHostOptions(host string, opts ...Option) ResolverOption {
+	return func(r *Resolver) {
+		host = endpointHost(host)
+		r.hostOpts[host] = append(r.hostOpts[host], opts...)
+	}
+}
+
+// NewResolver creates the resolver
+func NewResolver(opts ...ResolverOption) *Resolver {
+	r := &Resolver{
+		opts:     []Option{WithCredentials(DockerConfigCredentials())},
+		hostOpts: make(map[string][]Option),
+		clients:  make(map[string]*Client),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// endpointHost returns the host of the registry API, the docker hub
+// is served by registry-1.docker.io
+func endpointHost(host string) string {
+	host = normalizeHost(host)
+	if isDockerHub(host) {
+		return dockerHubEndpoint
+	}
+	return host
+}
+
+// Client returns the client of the registry host
+func (r *Resolver) Client(host string) (Registry, error) {
+	c, err := r.client(host)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (r *Resolver) client(host string) (*Client, error) {
+	host = endpointHost(host)
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	if c, ok := r.clients[host]; ok {
+		return c, nil
+	}
+	opts := append(append([]Option{}, r.opts...), r.hostOpts[host]...)
+	reg, err := New(host, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c := reg.(*Client)
+	r.clients[host] = c
+	return c, nil
+}
+
+// clientOf returns the client of the registry of the reference
+func (r *Resolver) clientOf(ref string) (*Client, error) {
+	parsed, err := ParseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	return r.client(parsed.Host)
+}
+
+// Repos lists the repositories of the registry host
+func (r *Resolver) Repos(ctx context.Context, host string,
+	opts *ListRepoOptions) ([]Repository, error) {
+
+	c, err := r.client(host)
+	if err != nil {
+		return nil, err
+	}
+	return c.Repos(ctx, opts)
+}
+
+// IterRepos returns the iterator of the repositories of the registry host
+func (r *Resolver) IterRepos(ctx context.Context, host string,
+	opts *ListRepoOptions) (*RepoIterator, error) {
+
+	c, err := r.client(host)
+	if err != nil {
+		return nil, err
+	}
+	return c.IterRepos(ctx, opts)
+}
+
+// Tags lists the tags of the repository of the reference
+func (r *Resolver) Tags(ctx context.Context, ref string,
+	opts *ListTagOptions) ([]Tag, error) {
+
+	c, err := r.clientOf(ref)
+	if err != nil {
+		return nil, err
+	}
+	return c.Tags(ctx, ref, opts)
+}
+
+// IterTags returns the iterator of the tags of the repository of the
+// reference
+func (r *Resolver) IterTags(ctx context.Context, ref string,
+	opts *ListTagOptions) (*TagIterator, error) {
+
+	c, err := r.clientOf(ref)
+	if err != nil {
+		return nil, err
+	}
+	return c.IterTags(ctx, ref, opts)
+}
+
+// Image gets the image of the reference, the tag is latest if the
+// reference has neither tag nor digest
+func (r *Resolver) Image(ctx context.Context, ref string) (*Image, error) {
+	c, err := r.clientOf(ref)
+	if err != nil {
+		return nil, err
+	}
+	return c.Image(ctx, ref, "")
+}
+
+// Download downloads the image of the reference to the target
+func (r *Resolver) Download(ctx context.Context, ref, target string) error {
+	c, err := r.clientOf(ref)
+	if err != nil {
+		return err
+	}
+	return c.Download(ctx, ref, target)
+}
+
+// Ping pings the registry host
+func (r *Resolver) Ping(ctx context.Context, host string) (Capabilities, error) {
+	c, err := r.client(host)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	return c.Ping(ctx)
+}
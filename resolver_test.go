@@ -0,0 +1,69 @@
+package reglib
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// tagsRegistry responds the tags of any repository, the tags are
+// named after the registry
+func tagsRegistry(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, _ := r.BasicAuth()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"name":"app","tags":["%s-%s"]}`, name, user)
+	}))
+}
+
+func TestResolver(t *testing.T) {
+	setupDockerConfig(t, `{"auths":{}}`)
+	a, b := tagsRegistry("a"), tagsRegistry("b")
+	defer a.Close()
+	defer b.Close()
+	hostA, _ := url.Parse(a.URL)
+	hostB, _ := url.Parse(b.URL)
+
+	r := NewResolver(
+		WithHostOptions(hostB.Host, WithBasicAuth("bob", "secret")),
+	)
+	for ref, expect := range map[string]string{
+		hostA.Host + "/org/app:v1":   "a-",
+		hostB.Host + "/app":          "b-bob",
+		a.URL + "/not-a-reference":   "",
+		"Upper.io/invalid/Reference": "",
+	} {
+		tags, err := r.Tags(context.Background(), ref, nil)
+		if expect == "" {
+			if err == nil {
+				t.Errorf("%s: expect error", ref)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", ref, err)
+			continue
+		}
+		if len(tags) != 1 || tags[0].Name != expect {
+			t.Errorf("%s: expect tag %s, got %v", ref, expect, ExtractTagNames(tags))
+		}
+	}
+
+	c1, _ := r.Client(hostA.Host)
+	c2, _ := r.Client("http://" + hostA.Host)
+	if c1 != c2 {
+		t.Error("the client is not cached")
+	}
+	if len(r.clients) != 2 {
+		t.Errorf("expect 2 clients, got %d", len(r.clients))
+	}
+
+	for _, host := range []string{"docker.io", "index.docker.io", "https://index.docker.io/v1/"} {
+		if got := endpointHost(host); got != dockerHubEndpoint {
+			t.Errorf("%s: expect %s, got %s", host, dockerHubEndpoint, got)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package reglib
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures the retries of the idempotent requests
+// (GET and HEAD, including the ranged blob reads)
+type RetryPolicy struct {
+	// MaxRetries is the max number of the retries, zero disables retrying
+	MaxRetries int
+	// MinBackoff is the backoff of the first retry, it's doubled
+	// for the next ones until MaxBackoff, the backoffs are jittered
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Statuses are the HTTP statuses to retry, the requests failed
+	// without a response are retried unless the context is done
+	Statuses []int
+}
+
+// DefaultRetryPolicy retries 3 times on 429, 502, 503 and 504
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	MinBackoff: 200 * time.Millisecond,
+	MaxBackoff: 10 * time.Second,
+	Statuses: []int{
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+// backoff returns the jittered backoff of the attempt (start from 0)
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.MinBackoff
+	for i := 0; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	// [d/2, d)
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (p RetryPolicy) retryStatus(code int) bool {
+	for _, status := range p.Statuses {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+// retryTransport retries the idempotent requests with the policy
+type retryTransport struct {
+	next   http.RoundTripper
+	policy RetryPolicy
+	logger Logger
+}
+
+func newRetryTransport(next http.RoundTripper, policy RetryPolicy, logger Logger) http.RoundTripper {
+	if policy.MaxRetries <= 0 {
+		return next
+	}
+	return &retryTransport{next: next, policy: policy, logger: logger}
+}
+
+// noRetryKey is the ctx key of the requests which are not retried
+type noRetryKey struct{}
+
+// withoutRetry returns the ctx whose requests are not retried, e.g. the
+// ones to the mirrors, which fail over by their health instead
+func withoutRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if (req.Method != "GET" && req.Method != "HEAD") ||
+		req.Context().Value(noRetryKey{}) != nil {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if attempt >= t.policy.MaxRetries || ctx.Err() != nil {
+			return resp, err
+		}
+		if err != nil && !retryableError(err) {
+			return resp, err
+		}
+		if err == nil && !t.policy.retryStatus(resp.StatusCode) {
+			return resp, err
+		}
+
+		wait := t.policy.backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp); ok {
+				wait = after
+			}
+		}
+		// give up if the context can't wait that long
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return resp, err
+		}
+		if resp != nil {
+			drainBody(resp)
+		}
+		t.logger.Debug("retry request", "host", req.URL.Host,
+			"method", req.Method, "url", req.URL.String(), "attempt", attempt+1,
+			"backoff", wait, "cause", statusOrError(resp, err))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryAfter parses the Retry-After header, it's either the seconds
+// or an HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(v); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// retryableError reports whether the request failed by a transient error
+func retryableError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func statusOrError(resp *http.Response, err error) interface{} {
+	if err != nil {
+		return err
+	}
+	return resp.Status
+}
@@ -0,0 +1,119 @@
+package reglib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	var n int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&n, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			catalogHandler(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	policy := DefaultRetryPolicy
+	policy.MinBackoff = time.Millisecond
+
+	t.Run("retried", func(t *testing.T) {
+		atomic.StoreInt32(&n, 0)
+		if err := getCatalog(ts.URL, WithRetryPolicy(policy)); err != nil {
+			t.Fatal(err)
+		}
+		if got := atomic.LoadInt32(&n); got != 3 {
+			t.Errorf("expect 3 requests, got %d", got)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		atomic.StoreInt32(&n, 0)
+		if err := getCatalog(ts.URL, WithoutRetry()); err == nil {
+			t.Error("expect error without retry")
+		}
+		if got := atomic.LoadInt32(&n); got != 1 {
+			t.Errorf("expect 1 request, got %d", got)
+		}
+	})
+
+	t.Run("not idempotent", func(t *testing.T) {
+		atomic.StoreInt32(&n, 0)
+		rt := newRetryTransport(http.DefaultTransport, policy, nopLogger{})
+		req, _ := http.NewRequest("POST", ts.URL, nil)
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("expect 503, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestRetryAfterDeadline(t *testing.T) {
+	var n int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&n, 1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL, nil)
+
+	start := time.Now()
+	resp, err := newRetryTransport(http.DefaultTransport, DefaultRetryPolicy, nopLogger{}).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expect 429, got %d", resp.StatusCode)
+	}
+	if atomic.LoadInt32(&n) != 1 || time.Since(start) > 500*time.Millisecond {
+		t.Error("should not wait beyond the deadline")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	for v, expect := range map[string]time.Duration{
+		"3":   3 * time.Second,
+		date:  time.Hour,
+		"bad": -1,
+	} {
+		resp := &http.Response{Header: http.Header{"Retry-After": {v}}}
+		d, ok := retryAfter(resp)
+		if expect < 0 {
+			if ok {
+				t.Errorf("%q: expect invalid", v)
+			}
+			continue
+		}
+		if !ok || d > expect || d < expect-2*time.Second {
+			t.Errorf("%q: expect %s, got %s", v, expect, d)
+		}
+	}
+
+	p := RetryPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		if d := p.backoff(attempt); d < max/2 || d > max {
+			t.Errorf("attempt %d: backoff %s not in [%s, %s]", attempt, d, max/2, max)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package reglib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TagOrder is the order of the listed tags
+type TagOrder int
+
+const (
+	// TagOrderDefault keeps the order of the registry
+	TagOrderDefault TagOrder = iota
+	// TagOrderLexical sorts the tags by their names
+	TagOrderLexical
+	// TagOrderSemver sorts the tags by the semantic versions, e.g.
+	// "v1.2.3", "1.2" and "2.0.0-rc.1", the other tags come last
+	TagOrderSemver
+	// TagOrderCreated sorts the tags by the creation time of the images,
+	// the config of the image of each tag is fetched, the tags whose
+	// creation time is unknown come last
+	TagOrderCreated
+)
+
+func (o TagOrder) String() string {
+	switch o {
+	case TagOrderDefault:
+		return "default"
+	case TagOrderLexical:
+		return "lexical"
+	case TagOrderSemver:
+		return "semver"
+	case TagOrderCreated:
+		return "created"
+	}
+	return "TagOrder(" + strconv.Itoa(int(o)) + ")"
+}
+
+// tagKey is the sort key of a tag, known is false if the version or the
+// creation time of the tag is unknown
+type tagKey struct {
+	name    string
+	known   bool
+	version semver
+	created time.Time
+}
+
+// sortTags sorts the tags by the order, the tags whose keys are unknown
+// are placed at the end in lexical order
+func sortTags(names []string, order TagOrder, reverse bool, created map[string]time.Time) {
+	keys := make([]tagKey, len(names))
+	for i, name := range names {
+		key := tagKey{name: name, known: true}
+		switch order {
+		case TagOrderSemver:
+			key.version, key.known = parseSemver(name)
+		case TagOrderCreated:
+			key.created, key.known = created[name]
+		}
+		keys[i] = key
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.known != b.known {
+			return a.known
+		}
+		c := 0
+		if a.known {
+			switch order {
+			case TagOrderSemver:
+				c = a.version.compare(b.version)
+			case TagOrderCreated:
+				if a.created.Before(b.created) {
+					c = -1
+				} else if a.created.After(b.created) {
+					c = 1
+				}
+			}
+		}
+		if c == 0 {
+			c = strings.Compare(a.name, b.name)
+		}
+		if reverse && a.known {
+			c = -c
+		}
+		return c < 0
+	})
+	for i, key := range keys {
+		names[i] = key.name
+	}
+}
+
+// semver is the semantic version, see https://semver.org, the "v"
+// prefix and the missing minor and patch numbers are allowed
+type semver struct {
+	nums [3]uint64
+	pre  []string
+}
+
+func parseSemver(s string) (semver, bool) {
+	v := semver{}
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		if i == len(s)-1 {
+			return v, false
+		}
+		v.pre = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, false
+	}
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return v, false
+		}
+		v.nums[i] = n
+	}
+	return v, true
+}
+
+// compare returns -1, 0 or 1 if v is lower than, equal to or higher
+// than o, the pre-release version is lower than the release
+func (v semver) compare(o semver) int {
+	for i := range v.nums {
+		if v.nums[i] != o.nums[i] {
+			if v.nums[i] < o.nums[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(v.pre) == 0 && len(o.pre) == 0:
+		return 0
+	case len(v.pre) == 0:
+		return 1
+	case len(o.pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.pre) && i < len(o.pre); i++ {
+		if c := comparePrerelease(v.pre[i], o.pre[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.pre) < len(o.pre):
+		return -1
+	case len(v.pre) > len(o.pre):
+		return 1
+	}
+	return 0
+}
+
+// comparePrerelease compares the identifiers of the pre-release, the
+// numeric ones are lower than the alphanumeric ones
+func comparePrerelease(a, b string) int {
+	x, errA := strconv.ParseUint(a, 10, 64)
+	y, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// tagsCreated returns the creation time of the images of the tags, the
+// failed tags are absent, it fails only if the ctx is done
+func (c *Client) tagsCreated(ctx context.Context, repo string, tags []string) (map[string]time.Time, error) {
+	var (
+		mutex   sync.Mutex
+		wg      sync.WaitGroup
+		created = make(map[string]time.Time, len(tags))
+		sem     = make(chan struct{}, defaultTagWorkers)
+	)
+	for _, tag := range tags {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, ctx.Err()
+		}
+		wg.Add(1)
+		go func(tag string) {
+			defer func() { <-sem; wg.Done() }()
+			t, err := c.tagCreated(ctx, repo, tag)
+			if err != nil {
+				c.logger.Warn("get creation time error", "repo", repo, "tag", tag, "error", err)
+				return
+			}
+			mutex.Lock()
+			created[tag] = t
+			mutex.Unlock()
+		}(tag)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// tagCreated returns the creation time of the image of the tag by the
+// config of the schemav2 manifest
+func (c *Client) tagCreated(ctx context.Context, repo, tag string) (time.Time, error) {
+	r, err := c.newRepo(ctx, repo)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ms, err := r.Manifests(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	m, err := manifestV2(ctx, ms, tag, "")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("get schamev2 error: %w", registryError(err))
+	}
+	if m.Config.Digest == "" {
+		return time.Time{}, errors.New("the manifest has no config")
+	}
+	blob, err := r.Blobs(ctx).Get(ctx, m.Config.Digest)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("get config error: %w", registryError(err))
+	}
+	config := struct {
+		Created time.Time `json:"created"`
+	}{}
+	if err := json.Unmarshal(blob, &config); err != nil {
+		return time.Time{}, fmt.Errorf("decode config error: %w", err)
+	}
+	if config.Created.IsZero() {
+		return time.Time{}, errors.New("the config has no creation time")
+	}
+	return config.Created, nil
+}
@@ -0,0 +1,119 @@
+package reglib
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+func TestParseSemver(t *testing.T) {
+	for s, ok := range map[string]bool{
+		"1.2.3":        true,
+		"v1.2.3":       true,
+		"1.2":          true,
+		"3":            true,
+		"1.2.3-rc.1":   true,
+		"1.2.3+build5": true,
+		"1.2.3.4":      false,
+		"1.2.3-":       false,
+		"latest":       false,
+		"v":            false,
+		"1.x":          false,
+	} {
+		if _, got := parseSemver(s); got != ok {
+			t.Errorf("%s: got %v, want %v", s, got, ok)
+		}
+	}
+}
+
+func TestSortTags(t *testing.T) {
+	tags := []string{"latest", "1.10.0", "v1.2.0", "1.2.0-rc.2", "1.2.0-rc.10", "1.2.0-beta", "2", "main"}
+	now := time.Now()
+	created := map[string]time.Time{
+		"1.10.0": now.Add(-time.Hour),
+		"v1.2.0": now.Add(-2 * time.Hour),
+		"2":      now,
+	}
+	for _, c := range []struct {
+		order   TagOrder
+		reverse bool
+		want    []string
+	}{
+		{TagOrderLexical, false,
+			[]string{"1.10.0", "1.2.0-beta", "1.2.0-rc.10", "1.2.0-rc.2", "2", "latest", "main", "v1.2.0"}},
+		{TagOrderLexical, true,
+			[]string{"v1.2.0", "main", "latest", "2", "1.2.0-rc.2", "1.2.0-rc.10", "1.2.0-beta", "1.10.0"}},
+		{TagOrderSemver, false,
+			[]string{"1.2.0-beta", "1.2.0-rc.2", "1.2.0-rc.10", "v1.2.0", "1.10.0", "2", "latest", "main"}},
+		{TagOrderSemver, true,
+			[]string{"2", "1.10.0", "v1.2.0", "1.2.0-rc.10", "1.2.0-rc.2", "1.2.0-beta", "latest", "main"}},
+		{TagOrderCreated, true,
+			[]string{"2", "1.10.0", "v1.2.0", "1.2.0-beta", "1.2.0-rc.10", "1.2.0-rc.2", "latest", "main"}},
+	} {
+		got := append([]string{}, tags...)
+		sortTags(got, c.order, c.reverse, created)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s reverse=%v: got %v, want %v", c.order, c.reverse, got, c.want)
+		}
+	}
+}
+
+func TestTagsOrderCreated(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	created := map[string]time.Time{
+		"a": now.Add(-time.Hour),
+		"b": now,
+		"c": now.Add(-2 * time.Hour),
+	}
+	// the digests of the configs of the tags, and the configs
+	digests, configs := map[string]string{}, map[string]string{}
+	for tag, t := range created {
+		config := fmt.Sprintf(`{"created":%q}`, t.Format(time.RFC3339))
+		digests[tag] = digest.FromString(config).String()
+		configs[digests[tag]] = config
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/app/tags/list":
+			w.Write([]byte(`{"name":"app","tags":["a","b","c","d"]}`))
+		case strings.HasPrefix(r.URL.Path, "/v2/app/manifests/"):
+			tag := strings.TrimPrefix(r.URL.Path, "/v2/app/manifests/")
+			dgst, ok := digests[tag]
+			if !ok {
+				writeRegistryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+				return
+			}
+			w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+			fmt.Fprintf(w, `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json",`+
+				`"config":{"mediaType":"application/vnd.docker.container.image.v1+json","size":%d,"digest":%q},"layers":[]}`,
+				len(configs[dgst]), dgst)
+		case strings.HasPrefix(r.URL.Path, "/v2/app/blobs/"):
+			config, ok := configs[strings.TrimPrefix(r.URL.Path, "/v2/app/blobs/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Length", fmt.Sprint(len(config)))
+			w.Write([]byte(config))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	r, err := New(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := listTagNames(t, r, &ListTagOptions{Order: TagOrderCreated, Reverse: true, Limit: 3})
+	// the creation time of d is unknown
+	if want := []string{"b", "a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
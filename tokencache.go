@@ -0,0 +1,253 @@
+package reglib
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// the default lifetime of the tokens, see
+	// https://docs.docker.com/registry/spec/auth/token/#token-response-fields
+	defaultTokenExpiresIn = 60
+	// the max duration before the expiry to refresh a token
+	maxTokenRefreshBefore = 30 * time.Second
+	// the timeout of the fetches and the background refreshes, they are
+	// shared by the callers so not canceled by any of them
+	tokenRefreshTimeout = 30 * time.Second
+)
+
+type cachedToken struct {
+	Token     string    `json:"token"`
+	RefreshAt time.Time `json:"refresh_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func newCachedToken(t token, issuedAt time.Time) cachedToken {
+	expiresIn := t.ExpiresIn
+	if expiresIn <= 0 {
+		expiresIn = defaultTokenExpiresIn
+	}
+	ttl := time.Duration(expiresIn) * time.Second
+	refreshBefore := ttl / 5
+	if refreshBefore > maxTokenRefreshBefore {
+		refreshBefore = maxTokenRefreshBefore
+	}
+	return cachedToken{
+		Token:     t.Token,
+		RefreshAt: issuedAt.Add(ttl - refreshBefore),
+		ExpiresAt: issuedAt.Add(ttl),
+	}
+}
+
+// tokenCall is an in-flight fetch of a token
+type tokenCall struct {
+	done chan struct{}
+	t    cachedToken
+	err  error
+}
+
+// tokenFetcher fetches a new token, the returned token's IssuedAt is
+// ignored since the clock of the registry may not the same as ours
+type tokenFetcher func(ctx context.Context) (token, error)
+
+// tokenCache caches the bearer tokens by realm, service and scopes, the
+// concurrent fetches of the same key are deduplicated
+type tokenCache struct {
+	m      sync.Mutex
+	tokens map[string]cachedToken
+	calls  map[string]*tokenCall
+	// persist the tokens to the file if set
+	file    string
+	logger  Logger
+	metrics MetricsCollector
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{
+		tokens:  make(map[string]cachedToken, 100),
+		calls:   make(map[string]*tokenCall),
+		logger:  nopLogger{},
+		metrics: nopMetrics{},
+	}
+}
+
+// tokenCacheKey returns the key of the token of the credential, the
+// scopes are sorted and deduplicated
+func tokenCacheKey(auth AuthConfig, realm, service string, scopes []string) string {
+	set := make(map[string]bool, len(scopes))
+	sorted := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if scope != "" && !set[scope] {
+			set[scope] = true
+			sorted = append(sorted, scope)
+		}
+	}
+	sort.Strings(sorted)
+	return credentialID(auth) + "|" + realm + "|" + service + "|" + strings.Join(sorted, " ")
+}
+
+// credentialID identifies the account of the credential, so the tokens
+// of an account aren't used by another one sharing the cache file. The
+// password isn't hashed to keep it out of the file, it's empty for the
+// anonymous access
+func credentialID(auth AuthConfig) string {
+	if auth.Username == "" && auth.IdentityToken == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(auth.Username + "\x00" + auth.IdentityToken))
+	return hex.EncodeToString(sum[:8])
+}
+
+// get returns the token of the key, the token is fetched if it's absent or
+// expired, and refreshed in the background if it's going to expire
+func (c *tokenCache) get(ctx context.Context, key string, fetch tokenFetcher) (string, error) {
+	now := time.Now()
+	c.m.Lock()
+	t, exist := c.tokens[key]
+	c.m.Unlock()
+	hit := exist && now.Before(t.ExpiresAt)
+	c.metrics.TokenCacheLookup(hit)
+	if hit {
+		if !now.Before(t.RefreshAt) {
+			go func() {
+				if _, err := c.fetch(context.Background(), key, fetch); err != nil {
+					c.logger.Warn("refresh token error", "key", key, "error", err)
+				}
+			}()
+		}
+		return t.Token, nil
+	}
+
+	t, err := c.fetch(ctx, key, fetch)
+	return t.Token, err
+}
+
+// fetch a new token, or wait for the in-flight one, the fetch is shared
+// by the callers, each of them gives up only when its own ctx is done
+func (c *tokenCache) fetch(ctx context.Context, key string, fetch tokenFetcher) (cachedToken, error) {
+	c.m.Lock()
+	call, inflight := c.calls[key]
+	if !inflight {
+		call = &tokenCall{done: make(chan struct{})}
+		c.calls[key] = call
+		// keep the values of the ctx, e.g. the tracing span
+		go c.do(withValues(context.Background(), ctx), key, call, fetch)
+	}
+	c.m.Unlock()
+
+	select {
+	case <-call.done:
+		return call.t, call.err
+	case <-ctx.Done():
+		return cachedToken{}, ctx.Err()
+	}
+}
+
+// do fetches the token of the call within tokenRefreshTimeout
+func (c *tokenCache) do(ctx context.Context, key string, call *tokenCall, fetch tokenFetcher) {
+	ctx, cancel := context.WithTimeout(ctx, tokenRefreshTimeout)
+	defer cancel()
+
+	issuedAt := time.Now()
+	t, err := fetch(ctx)
+	if err == nil {
+		call.t = newCachedToken(t, issuedAt)
+	}
+	call.err = err
+
+	c.m.Lock()
+	delete(c.calls, key)
+	if err == nil {
+		c.tokens[key] = call.t
+	}
+	c.m.Unlock()
+	close(call.done)
+
+	if err == nil && c.file != "" {
+		if err := c.save(); err != nil {
+			c.logger.Warn("save token cache error", "file", c.file, "error", err)
+		}
+	}
+}
+
+// invalidate removes the token of the key if it's still the given one
+func (c *tokenCache) invalidate(key, tokenString string) {
+	c.m.Lock()
+	if t, exist := c.tokens[key]; exist && t.Token == tokenString {
+		delete(c.tokens, key)
+	}
+	c.m.Unlock()
+}
+
+// persist loads the tokens from the file and saves the tokens to it
+// whenever a new token is fetched
+func (c *tokenCache) persist(file string) error {
+	c.m.Lock()
+	c.file = file
+	c.m.Unlock()
+
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	tokens := make(map[string]cachedToken)
+	if err := json.Unmarshal(bs, &tokens); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	c.m.Lock()
+	defer c.m.Unlock()
+	for key, t := range tokens {
+		if _, exist := c.tokens[key]; !exist && now.Before(t.ExpiresAt) {
+			c.tokens[key] = t
+		}
+	}
+	return nil
+}
+
+// save the unexpired tokens to the file
+func (c *tokenCache) save() error {
+	now := time.Now()
+	c.m.Lock()
+	tokens := make(map[string]cachedToken, len(c.tokens))
+	for key, t := range c.tokens {
+		if now.Before(t.ExpiresAt) {
+			tokens[key] = t
+		}
+	}
+	c.m.Unlock()
+
+	bs, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.file), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(c.file), filepath.Base(c.file))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.file)
+}
@@ -0,0 +1,262 @@
+package reglib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenCacheKey(t *testing.T) {
+	alice := AuthConfig{Username: "alice", Password: "secret"}
+	a := tokenCacheKey(alice, "realm", "svc", []string{"repository:a:pull", "registry:catalog:*"})
+	b := tokenCacheKey(alice, "realm", "svc", []string{"registry:catalog:*", "repository:a:pull", ""})
+	if a != b {
+		t.Errorf("%s != %s", a, b)
+	}
+	if a == tokenCacheKey(alice, "realm", "svc", []string{"repository:a:pull"}) {
+		t.Errorf("different scopes got the same key %s", a)
+	}
+	for _, auth := range []AuthConfig{
+		{},
+		{Username: "bob", Password: "secret"},
+		{Username: "alice", IdentityToken: "token"},
+	} {
+		if a == tokenCacheKey(auth, "realm", "svc", []string{"repository:a:pull", "registry:catalog:*"}) {
+			t.Errorf("%+v got the key of alice %s", auth, a)
+		}
+	}
+	if strings.Contains(a, "alice") || strings.Contains(a, "secret") {
+		t.Errorf("the key %s leaks the credential", a)
+	}
+}
+
+func TestTokenCache(t *testing.T) {
+	ctx := context.Background()
+	var fetched int32
+	fetch := func(context.Context) (token, error) {
+		time.Sleep(10 * time.Millisecond)
+		n := atomic.AddInt32(&fetched, 1)
+		return token{Token: string('a' + n - 1)}, nil
+	}
+
+	t.Run("dedup", func(t *testing.T) {
+		c := newTokenCache()
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if tk, err := c.get(ctx, "k", fetch); err != nil || tk != "a" {
+					t.Errorf("got %s %v", tk, err)
+				}
+			}()
+		}
+		wg.Wait()
+		if n := atomic.LoadInt32(&fetched); n != 1 {
+			t.Errorf("fetched %d times", n)
+		}
+	})
+
+	t.Run("default expiry", func(t *testing.T) {
+		now := time.Now()
+		ct := newCachedToken(token{Token: "a"}, now)
+		if ct.ExpiresAt != now.Add(defaultTokenExpiresIn*time.Second) {
+			t.Errorf("expires at %s", ct.ExpiresAt)
+		}
+		if !ct.RefreshAt.Before(ct.ExpiresAt) {
+			t.Errorf("refresh at %s", ct.RefreshAt)
+		}
+	})
+
+	t.Run("refresh before expiry", func(t *testing.T) {
+		atomic.StoreInt32(&fetched, 0)
+		c := newTokenCache()
+		c.tokens["k"] = cachedToken{
+			Token:     "old",
+			RefreshAt: time.Now().Add(-time.Second),
+			ExpiresAt: time.Now().Add(time.Minute),
+		}
+		if tk, _ := c.get(ctx, "k", fetch); tk != "old" {
+			t.Errorf("got %s", tk)
+		}
+		for i := 0; i < 100 && atomic.LoadInt32(&fetched) == 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if tk, _ := c.get(ctx, "k", fetch); tk != "a" {
+			t.Errorf("not refreshed, got %s", tk)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		atomic.StoreInt32(&fetched, 0)
+		c := newTokenCache()
+		c.tokens["k"] = cachedToken{Token: "old", ExpiresAt: time.Now()}
+		if tk, _ := c.get(ctx, "k", fetch); tk != "a" {
+			t.Errorf("got %s", tk)
+		}
+		c.invalidate("k", "a")
+		if tk, _ := c.get(ctx, "k", fetch); tk != "b" {
+			t.Errorf("got %s", tk)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		c := newTokenCache()
+		slow := func(ctx context.Context) (token, error) {
+			select {
+			case <-time.After(50 * time.Millisecond):
+				return token{Token: "a"}, nil
+			case <-ctx.Done():
+				return token{}, ctx.Err()
+			}
+		}
+		canceled, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() {
+			_, err := c.get(canceled, "k", slow)
+			done <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+		// the waiter gets the token though the first caller gives up
+		waiter := make(chan string)
+		go func() {
+			tk, err := c.get(ctx, "k", slow)
+			if err != nil {
+				t.Error(err)
+			}
+			waiter <- tk
+		}()
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Errorf("got %v", err)
+		}
+		if tk := <-waiter; tk != "a" {
+			t.Errorf("got %s", tk)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		c := newTokenCache()
+		_, err := c.get(ctx, "k", func(context.Context) (token, error) {
+			return token{}, errors.New("failed")
+		})
+		if err == nil {
+			t.Error("expect an error")
+		}
+		if _, exist := c.tokens["k"]; exist {
+			t.Error("the failed token is cached")
+		}
+	})
+
+	t.Run("persist", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "reglib", "tokens.json")
+		c := newTokenCache()
+		if err := c.persist(file); err != nil {
+			t.Fatal(err)
+		}
+		c.get(ctx, "k", func(context.Context) (token, error) {
+			return token{Token: "persisted"}, nil
+		})
+
+		c = newTokenCache()
+		if err := c.persist(file); err != nil {
+			t.Fatal(err)
+		}
+		tk, err := c.get(ctx, "k", func(context.Context) (token, error) {
+			return token{}, errors.New("should not fetch")
+		})
+		if err != nil || tk != "persisted" {
+			t.Errorf("got %s %v", tk, err)
+		}
+	})
+}
+
+func TestTokenReused(t *testing.T) {
+	var fetched, rejected int32
+	registry, tokenServer := newTokenRegistry(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetched, 1)
+		w.Write([]byte(`{"token":"valid","expires_in":300}`))
+	})
+	defer registry.Close()
+	defer tokenServer.Close()
+	registry.Config.Handler = countUnauthorized(registry.Config.Handler, &rejected)
+
+	r, err := New(registry.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := r.Repos(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fetched != 1 || rejected != 1 {
+		t.Errorf("fetched %d tokens and rejected %d times", fetched, rejected)
+	}
+}
+
+func countUnauthorized(h http.Handler, n *int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(&statusRecorder{ResponseWriter: w, onStatus: func(code int) {
+			if code == http.StatusUnauthorized {
+				atomic.AddInt32(n, 1)
+			}
+		}}, r)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	onStatus func(int)
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.onStatus(code)
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func TestTokenCacheFileAccounts(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, _ := r.BasicAuth()
+		w.Write([]byte(`{"token":"token-` + user + `","expires_in":300}`))
+	}))
+	defer tokenServer.Close()
+	var bearers []string
+	var m sync.Mutex
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+tokenServer.URL+
+				`/token",service="test",scope="registry:catalog:*"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		m.Lock()
+		bearers = append(bearers, r.Header.Get("Authorization"))
+		m.Unlock()
+		catalogHandler(w, r)
+	}))
+	defer registry.Close()
+
+	file := filepath.Join(t.TempDir(), "tokens.json")
+	for _, user := range []string{"alice", "bob"} {
+		r, err := New(registry.URL, WithBasicAuth(user, "secret"), WithTokenCacheFile(file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := catalogOf(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(bearers) != 2 || bearers[0] != "Bearer token-alice" || bearers[1] != "Bearer token-bob" {
+		t.Errorf("got bearers %v", bearers)
+	}
+}
@@ -0,0 +1,136 @@
+package reglib
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Tracer starts the spans of the client, it's shaped like the
+// OpenTelemetry tracer, see example/otel for the adapter. The client
+// starts a span for every logical operation (Repos, Tags, Image, Download
+// and the token exchange) and a child span for every HTTP request
+type Tracer interface {
+	// Start starts a span as a child of the span in the ctx, returns
+	// the ctx containing the new span
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is an operation traced, the keysAndValues are the alternating
+// keys and values of the attributes like the ones of the Logger
+type Span interface {
+	SetAttributes(keysAndValues ...interface{})
+	AddEvent(name string, keysAndValues ...interface{})
+	RecordError(err error)
+	End()
+}
+
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(...interface{})    {}
+func (nopSpan) AddEvent(string, ...interface{}) {}
+func (nopSpan) RecordError(error)               {}
+func (nopSpan) End()                            {}
+
+// startSpan starts the span of an operation against the registry
+func (c *Client) startSpan(ctx context.Context, name string,
+	keysAndValues ...interface{}) (context.Context, Span) {
+
+	ctx, span := c.tracer.Start(ctx, name)
+	span.SetAttributes(append([]interface{}{"registry.host", c.Host()}, keysAndValues...)...)
+	return ctx, span
+}
+
+// endSpan records the error of the span and ends it
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// tracingTransport starts a span for every request sent to the wire,
+// the DNS, connect and TLS timings are recorded as the events and the
+// attributes of the span
+type tracingTransport struct {
+	next   http.RoundTripper
+	tracer Tracer
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := t.tracer.Start(req.Context(), "HTTP "+req.Method)
+	span.SetAttributes(
+		"http.method", req.Method,
+		"http.url", req.URL.String(),
+		"net.peer.name", req.URL.Host,
+		"registry.operation", requestOperation(req),
+	)
+
+	// the hooks may be called concurrently, e.g. dialing the IPv4 and
+	// IPv6 addresses at the same time
+	var (
+		m                                sync.Mutex
+		dnsStart, connectStart, tlsStart time.Time
+	)
+	since := func(start *time.Time) time.Duration {
+		m.Lock()
+		defer m.Unlock()
+		return time.Since(*start)
+	}
+	mark := func(start *time.Time) {
+		m.Lock()
+		*start = time.Now()
+		m.Unlock()
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mark(&dnsStart)
+			span.AddEvent("dns.start")
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			span.AddEvent("dns.done", "error", info.Err)
+			span.SetAttributes("dns.duration", since(&dnsStart))
+		},
+		ConnectStart: func(network, addr string) {
+			mark(&connectStart)
+			span.AddEvent("connect.start", "net.peer.addr", addr)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			span.AddEvent("connect.done", "net.peer.addr", addr, "error", err)
+			span.SetAttributes("connect.duration", since(&connectStart))
+		},
+		TLSHandshakeStart: func() {
+			mark(&tlsStart)
+			span.AddEvent("tls.start")
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			span.AddEvent("tls.done", "error", err)
+			span.SetAttributes("tls.duration", since(&tlsStart))
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			span.SetAttributes("net.conn.reused", info.Reused)
+		},
+		GotFirstResponseByte: func() {
+			span.AddEvent("first_response_byte")
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	span.SetAttributes("http.status_code", resp.StatusCode)
+	span.End()
+	return resp, nil
+}
@@ -0,0 +1,121 @@
+package reglib
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type spanKey struct{}
+
+// recordTracer records the spans as "<parent>/<name>"
+type recordTracer struct {
+	m     sync.Mutex
+	spans []*recordSpan
+}
+
+type recordSpan struct {
+	path  string
+	attrs map[string]interface{}
+	err   error
+	ended bool
+}
+
+func (t *recordTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	path := name
+	if parent, ok := ctx.Value(spanKey{}).(*recordSpan); ok {
+		path = parent.path + "/" + name
+	}
+	s := &recordSpan{path: path, attrs: make(map[string]interface{})}
+	t.m.Lock()
+	t.spans = append(t.spans, s)
+	t.m.Unlock()
+	return context.WithValue(ctx, spanKey{}, s), &lockedSpan{m: &t.m, s: s}
+}
+
+func (t *recordTracer) paths() []string {
+	t.m.Lock()
+	defer t.m.Unlock()
+	paths := []string{}
+	for _, s := range t.spans {
+		if !s.ended {
+			paths = append(paths, s.path+" (not ended)")
+			continue
+		}
+		paths = append(paths, s.path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+type lockedSpan struct {
+	m *sync.Mutex
+	s *recordSpan
+}
+
+func (l *lockedSpan) SetAttributes(kv ...interface{}) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	for i := 0; i+1 < len(kv); i += 2 {
+		l.s.attrs[kv[i].(string)] = kv[i+1]
+	}
+}
+
+func (l *lockedSpan) AddEvent(string, ...interface{}) {}
+
+func (l *lockedSpan) RecordError(err error) {
+	l.m.Lock()
+	l.s.err = err
+	l.m.Unlock()
+}
+
+func (l *lockedSpan) End() {
+	l.m.Lock()
+	l.s.ended = true
+	l.m.Unlock()
+}
+
+func TestTracing(t *testing.T) {
+	registry, tokenServer := newTokenRegistry(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"token":"valid"}`))
+	})
+	defer registry.Close()
+	defer tokenServer.Close()
+
+	tracer := &recordTracer{}
+	r, err := New(registry.URL, WithTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Repos(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"reglib.Repos",
+		"reglib.Repos/HTTP GET",
+		"reglib.Repos/HTTP GET",
+		"reglib.Repos/reglib.Token",
+		"reglib.Repos/reglib.Token/HTTP GET",
+	}
+	if got := tracer.paths(); strings.Join(got, "|") != strings.Join(expect, "|") {
+		t.Errorf("expect spans %v, got %v", expect, got)
+	}
+
+	tracer.m.Lock()
+	defer tracer.m.Unlock()
+	for _, s := range tracer.spans {
+		if !strings.HasSuffix(s.path, "HTTP GET") {
+			continue
+		}
+		if s.attrs["http.status_code"] == nil || s.attrs["registry.operation"] == nil {
+			t.Errorf("%s: missing attributes %v", s.path, s.attrs)
+		}
+		if _, ok := s.attrs["connect.duration"]; !ok && s.attrs["net.conn.reused"] != true {
+			t.Errorf("%s: missing connect timing %v", s.path, s.attrs)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package reglib
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// the directory where the docker daemon looks for the certificates
+// of the registries, see https://docs.docker.com/engine/security/certificates/
+const defaultCertsDir = "/etc/docker/certs.d"
+
+// transport dials every registry host with its own TLS config, which is
+// the base config plus the CAs and client certificates in certsDir/<host>,
+// the insecure hosts skip the verification and fall back to plain HTTP
+type transport struct {
+	tlsConfig *tls.Config
+	certsDir  string
+	insecure  *insecureRegistries
+	maxConns  int
+	proxy     func(*http.Request) (*url.URL, error)
+	logger    Logger
+
+	m     sync.Mutex
+	hosts map[string]*hostTransport
+}
+
+type hostTransport struct {
+	*http.Transport
+	insecure bool
+	// set once the insecure host is found speaking plain HTTP
+	plainHTTP int32
+}
+
+func newTransport(tlsConfig *tls.Config, certsDir string, insecure *insecureRegistries,
+	maxConnsPerHost int, proxy func(*http.Request) (*url.URL, error), logger Logger) *transport {
+
+	return &transport{
+		tlsConfig: tlsConfig,
+		certsDir:  certsDir,
+		insecure:  insecure,
+		maxConns:  maxConnsPerHost,
+		proxy:     proxy,
+		logger:    logger,
+		hosts:     make(map[string]*hostTransport),
+	}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tr, err := t.transportFor(req.Context(), req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	if !tr.insecure || req.URL.Scheme != "https" {
+		return tr.RoundTrip(req)
+	}
+	if atomic.LoadInt32(&tr.plainHTTP) == 1 {
+		return tr.RoundTrip(plainHTTPRequest(req))
+	}
+
+	resp, err := tr.RoundTrip(req)
+	if err == nil || req.Context().Err() != nil ||
+		(req.Body != nil && req.GetBody == nil) {
+		return resp, err
+	}
+	t.logger.Info("fall back to HTTP", "host", req.URL.Host, "error", err)
+	resp, httpErr := tr.RoundTrip(plainHTTPRequest(req))
+	if httpErr != nil {
+		return nil, fmt.Errorf("%s (HTTP fallback: %s)", err, httpErr)
+	}
+	atomic.StoreInt32(&tr.plainHTTP, 1)
+	return resp, nil
+}
+
+// plainHTTPRequest returns a copy of the request using HTTP
+func plainHTTPRequest(req *http.Request) *http.Request {
+	r := req.Clone(req.Context())
+	r.URL.Scheme = "http"
+	if req.GetBody != nil {
+		r.Body, _ = req.GetBody()
+	}
+	return r
+}
+
+func (t *transport) transportFor(ctx context.Context, host string) (*hostTransport, error) {
+	t.m.Lock()
+	tr, exist := t.hosts[host]
+	t.m.Unlock()
+	if exist {
+		return tr, nil
+	}
+
+	// the hostname may be resolved, so it's matched without the lock to
+	// not block the requests to the other hosts
+	insecure := t.insecure != nil && t.insecure.match(ctx, host)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	tlsConfig, err := t.tlsConfigFor(host, insecure)
+	if err != nil {
+		return nil, err
+	}
+	tr = &hostTransport{
+		Transport: &http.Transport{
+			Proxy:               t.proxy,
+			MaxConnsPerHost:     t.maxConns,
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: t.maxConns,
+			TLSClientConfig:     tlsConfig,
+		},
+		insecure: insecure,
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+	// another request to the host may have made it
+	if exist, ok := t.hosts[host]; ok {
+		return exist, nil
+	}
+	t.hosts[host] = tr
+	return tr, nil
+}
+
+func (t *transport) tlsConfigFor(host string, insecure bool) (*tls.Config, error) {
+	cfg := &tls.Config{}
+	if t.tlsConfig != nil {
+		cfg = t.tlsConfig.Clone()
+	}
+	if insecure {
+		cfg.InsecureSkipVerify = true
+	}
+	if t.certsDir == "" {
+		return cfg, nil
+	}
+	if err := loadCertsDir(cfg, filepath.Join(t.certsDir, host)); err != nil {
+		return nil, fmt.Errorf("load certificates of %s error: %s", host, err)
+	}
+	return cfg, nil
+}
+
+// loadCertsDir adds the CAs (*.crt) and the client certificates
+// (*.cert with the *.key) in the dir to the config
+func loadCertsDir(cfg *tls.Config, dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var roots *x509.CertPool
+	for _, f := range files {
+		name := f.Name()
+		switch filepath.Ext(name) {
+		case ".crt":
+			if roots == nil {
+				roots = basePool(cfg)
+			}
+			pem, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				return err
+			}
+			if !roots.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("no certificate found in %s", name)
+			}
+		case ".cert":
+			keyName := strings.TrimSuffix(name, ".cert") + ".key"
+			cert, err := tls.LoadX509KeyPair(filepath.Join(dir, name), filepath.Join(dir, keyName))
+			if err != nil {
+				return fmt.Errorf("load %s and %s error: %s", name, keyName, err)
+			}
+			cfg.Certificates = append(cfg.Certificates, cert)
+		case ".key":
+			certName := strings.TrimSuffix(name, ".key") + ".cert"
+			if _, err := os.Stat(filepath.Join(dir, certName)); err != nil {
+				return fmt.Errorf("missing client certificate %s for key %s", certName, name)
+			}
+		}
+	}
+	if roots != nil {
+		cfg.RootCAs = roots
+	}
+	return nil
+}
+
+// basePool returns a copy of the configured root CAs, or the system's
+func basePool(cfg *tls.Config) *x509.CertPool {
+	if cfg.RootCAs != nil {
+		return cfg.RootCAs.Clone()
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		return x509.NewCertPool()
+	}
+	return pool
+}
@@ -0,0 +1,173 @@
+package reglib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func catalogHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"repositories":["alpine"]}`))
+}
+
+// newClientCert generates a self-signed client certificate, returns
+// the PEM encoded certificate and key
+func newClientCert(t *testing.T) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "reglib"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeCertsDir(t *testing.T, host string, files map[string][]byte) string {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, host), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, host, name), content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// getCatalog requests the catalog of the registry via the client, the
+// loopback registries are secure unless the opts say
+func getCatalog(baseURL string, opts ...Option) error {
+	opts = append([]Option{WithInsecureRegistries()}, opts...)
+	r, err := New(baseURL, opts...)
+	if err != nil {
+		return err
+	}
+	return catalogOf(r)
+}
+
+func catalogOf(r Registry) error {
+	c := r.(*Client)
+	resp, err := c.client.Get(c.baseURL + "/v2/_catalog")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func TestTLSRootCAs(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(catalogHandler))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+
+	t.Run("unknown CA", func(t *testing.T) {
+		if err := getCatalog(ts.URL, WithCertsDir("")); err == nil {
+			t.Error("expect an error")
+		}
+	})
+
+	t.Run("root CAs", func(t *testing.T) {
+		pool := x509.NewCertPool()
+		pool.AddCert(ts.Certificate())
+		if err := getCatalog(ts.URL, WithRootCAs(pool)); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("certs dir", func(t *testing.T) {
+		dir := writeCertsDir(t, u.Host, map[string][]byte{"ca.crt": caPEM})
+		if err := getCatalog(ts.URL, WithCertsDir(dir)); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	certPEM, keyPEM := newClientCert(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(certPEM)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(catalogHandler))
+	ts.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	ts.StartTLS()
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+
+	t.Run("without client certificate", func(t *testing.T) {
+		dir := writeCertsDir(t, u.Host, map[string][]byte{"ca.crt": caPEM})
+		if err := getCatalog(ts.URL, WithCertsDir(dir)); err == nil {
+			t.Error("expect an error")
+		}
+	})
+
+	t.Run("certs dir", func(t *testing.T) {
+		dir := writeCertsDir(t, u.Host, map[string][]byte{
+			"ca.crt":      caPEM,
+			"client.cert": certPEM,
+			"client.key":  keyPEM,
+		})
+		if err := getCatalog(ts.URL, WithCertsDir(dir)); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("option", func(t *testing.T) {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool := x509.NewCertPool()
+		pool.AddCert(ts.Certificate())
+		if err := getCatalog(ts.URL, WithRootCAs(pool), WithClientCertificate(cert)); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		dir := writeCertsDir(t, u.Host, map[string][]byte{"client.cert": certPEM})
+		if err := getCatalog(ts.URL, WithCertsDir(dir)); err == nil {
+			t.Error("expect an error")
+		}
+	})
+}
@@ -2,9 +2,10 @@ package reglib
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"strconv"
+	"regexp"
 	"sync"
 	"time"
 
@@ -33,7 +34,7 @@ func (r *Repository) Tags() ([]Tag, error) {
 	if r.cli == nil {
 		return nil, fmt.Errorf("nil client")
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := context.WithTimeout(context.Background(), r.cli.loadTimeout)
 	defer cancel()
 	tags, err := r.cli.Tags(ctx, r.Name, nil)
 	r.tags, r.tagErr = tags, err
@@ -61,7 +62,7 @@ func (t *Tag) Image() (*Image, error) {
 	if t.cli == nil {
 		return nil, errNilCli
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := context.WithTimeout(context.Background(), t.cli.loadTimeout)
 	defer cancel()
 	img, err := t.cli.Image(ctx, t.RepoName, t.Name)
 	t.image = img
@@ -91,15 +92,27 @@ type Image struct {
 	history []ImageHistory
 	size    ImageSize
 
-	c *Client
+	ref Reference
+	c   *Client
 }
 
-// FullName return the image name and it's tag
+// FullName return the image name and it's tag (or digest)
 func (i *Image) FullName() string {
-	if i.V1 == nil {
+	if i.V1 != nil {
+		return i.V1.Name + ":" + i.V1.Tag
+	}
+	if i.ref.Repository == "" {
 		return "error: cannot get name"
 	}
-	return i.V1.Name + ":" + i.V1.Tag
+	if i.ref.Tag == "" {
+		return i.ref.Repository + "@" + i.ref.Digest
+	}
+	return i.ref.Repository + ":" + i.ref.Tag
+}
+
+// Reference returns the reference of the image
+func (i *Image) Reference() Reference {
+	return i.ref
 }
 
 // History converts the v1's history info to reglib's history struct
@@ -161,74 +174,128 @@ func (i *Image) Size() ImageSize {
 	return i.size
 }
 
-// Download this image
-func (i *Image) Download(ctx context.Context, target string) error {
-	debug("start to download %s", i.FullName())
+// Download this image, the layers are saved as <target>.<index>.<hex>.tgz
+func (i *Image) Download(ctx context.Context, target string) (err error) {
+	if i.V2 == nil {
+		return fmt.Errorf("download %s error: no manifest", i.FullName())
+	}
+	repo := i.ref.Repository
+	ctx, span := i.c.startSpan(ctx, "reglib.Download", "repo", repo,
+		"tag", i.ref.Tag, "digest", i.ref.Digest, "layers", len(i.V2.Layers))
+	defer func() { endSpan(span, err) }()
+
+	i.c.logger.Debug("downloading image", "host", i.c.Host(), "repo", repo,
+		"tag", i.ref.Tag, "digest", i.ref.Digest, "layers", len(i.V2.Layers))
 	start := time.Now()
 
 	wg := new(sync.WaitGroup)
-	errChan := make(chan error, 10)
+	errChan := make(chan error, len(i.V2.Layers))
 
 	for index, layer := range i.V2.Layers {
-		path := fmt.Sprintf("/v2/%s/blobs/%s", i.V1.Name, layer.Digest)
 		wg.Add(1)
-		go func(index int, path, hex string) {
-			resp, err := i.c.client.Head(fmt.Sprintf("%s%s", i.c.baseURL, path))
-			if err != nil {
-				fmt.Println("head content error:", err)
-				return
-			}
-			resp.Body.Close()
-
-			length, err := strconv.Atoi(resp.Header.Get("Content-Length"))
-			if err != nil {
-				fmt.Println("bad content length:", err)
-				return
-			}
-
+		go func(index int, layer dis.Descriptor) {
 			defer wg.Done()
-			fName := fmt.Sprintf("%s.%d.%s.tgz", target, index, hex)
-			if err := i.c.parallelDownload(ctx, path, fName, length); err != nil {
-				fmt.Println("parallelDownload error:", err)
+			fName := fmt.Sprintf("%s.%d.%s.tgz", target, index, layer.Digest.Hex())
+			err := i.c.downloadBlob(ctx, repo, layer.Digest.String(), fName)
+			if err != nil {
+				errChan <- fmt.Errorf("download layer %s error: %w", layer.Digest, err)
 			}
-		}(index, path, layer.Digest.Hex())
+		}(index, layer)
 	}
 
-	go func() {
-		wg.Wait()
-		debug("done, use %s", time.Now().Sub(start))
-		close(errChan) // no error
-	}()
-
-	return <-errChan
+	wg.Wait()
+	close(errChan)
+	if err := <-errChan; err != nil {
+		return err
+	}
+	i.c.logger.Info("image downloaded", "host", i.c.Host(), "repo", repo,
+		"tag", i.ref.Tag, "digest", i.ref.Digest, "duration", time.Since(start))
+	return nil
 }
 
 // ListRepoOptions ...
 type ListRepoOptions struct {
-	WithTags   bool
+	// WithTags lists the tags of each repository, the tags are fetched
+	// ahead by the workers while the order of the catalog is kept
+	WithTags bool
+	// Workers is the number of the repositories whose tags are fetched
+	// ahead concurrently, it's 8 by default
+	Workers int
+	// Start and End select the repositories by their indexes in the
+	// listing after the filters below, the window is [Start, End) in
+	// the order of the catalog, End 0 means no limit. E.g. Start 10
+	// and End 20 list the 11th to the 20th matched repositories
 	Start, End int
-	Namespace  string
-	Prefix     string
+	// Namespace lists the repositories under the namespace only, it
+	// can be nested, e.g. "team/project" matches "team/project/app",
+	// while the Namespace of the Repository is "team"
+	Namespace string
+	// Prefix lists the repositories whose names start with it
+	Prefix string
+	// Glob lists the repositories matching the pattern of path.Match,
+	// e.g. "team/*/app", the "*" doesn't match the "/"
+	Glob string
+	// Regexp lists the repositories matching it
+	Regexp *regexp.Regexp
 }
 
 // ListTagOptions ...
 type ListTagOptions struct {
 	WithManifest bool
-	Prefix       string
+	// Prefix lists the tags starting with it, the listing starts from
+	// the prefix by the "last" parameter, as the registries respond the
+	// tags in lexical order
+	Prefix string
+	// Glob lists the tags matching the pattern of path.Match
+	Glob string
+	// Regexp lists the tags matching it
+	Regexp *regexp.Regexp
+	// Limit is the max number of the tags listed after the filters and
+	// the ordering, 0 means no limit
+	Limit int
+	// Order is the order of the tags, it's the order of the registry
+	// by default. The tags are listed all before they are sorted
+	Order TagOrder
+	// Reverse reverses the order, e.g. the newest tags come first
+	Reverse bool
 }
 
 type token struct {
-	Token     string    `json:"token,omitempty"`
-	ExpiresIn int       `json:"expires_in,omitempty"`
-	IssuedAt  time.Time `json:"issued_at,omitempty"`
-	Error     string    `json:"error,omitempty"`
-	typ       string
+	Token        string    `json:"token,omitempty"`
+	AccessToken  string    `json:"access_token,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresIn    int       `json:"expires_in,omitempty"`
+	IssuedAt     time.Time `json:"issued_at,omitempty"`
+	Error        string    `json:"error,omitempty"`
 }
 
 type dockerConfig struct {
-	Auths map[string]struct {
-		Auth string `json:"auth"`
-	} `json:"auths"`
+	Auths       map[string]dockerAuth `json:"auths"`
+	CredsStore  string                `json:"credsStore,omitempty"`
+	CredHelpers map[string]string     `json:"credHelpers,omitempty"`
+}
+
+type dockerAuth struct {
+	Auth          string `json:"auth"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
+
+// AuthConfig is the credential of a registry
+type AuthConfig struct {
+	Username string
+	Password string
+	// IdentityToken is used to exchange the bearer tokens instead of the
+	// username and password
+	IdentityToken string
+}
+
+func (a AuthConfig) empty() bool {
+	return a.Username == "" && a.Password == "" && a.IdentityToken == ""
+}
+
+// auth returns the base64 encoded "username:password"
+func (a AuthConfig) auth() string {
+	return base64.StdEncoding.EncodeToString([]byte(a.Username + ":" + a.Password))
 }
 
 // ImageHistory converted from json, thanks to https://mholt.github.io/json-to-go/
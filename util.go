@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/url"
 	"os"
 	"path"
@@ -14,6 +13,8 @@ import (
 
 const dockerConfigPath = ".docker/config.json"
 
+var dockerHubAliases = []string{"docker.io", "index.docker.io", "registry-1.docker.io"}
+
 func parseDockerConfig() (dockerConfig, error) {
 	dc := dockerConfig{}
 
@@ -25,6 +26,7 @@ func parseDockerConfig() (dockerConfig, error) {
 		}
 		return dc, err
 	}
+	defer f.Close()
 	bs, err := ioutil.ReadAll(f)
 	if err != nil {
 		return dc, err
@@ -35,29 +37,105 @@ func parseDockerConfig() (dockerConfig, error) {
 	}
 
 	// remove prefix and sufix
+	auths := make(map[string]dockerAuth, len(dc.Auths))
 	for addr, auth := range dc.Auths {
-		u, err := url.Parse(addr)
-		if err != nil {
-			continue
+		addr = normalizeHost(addr)
+		// special for docker.io
+		if isDockerHub(addr) {
+			for _, alias := range dockerHubAliases {
+				auths[alias] = auth
+			}
 		}
-
-		if u.Scheme != "" {
-			if u.Port() == "" {
-				addr = u.Hostname()
-			} else {
-				addr = fmt.Sprintf("%s:%s", u.Hostname(), u.Port())
+		auths[addr] = auth
+	}
+	dc.Auths = auths
+
+	helpers := make(map[string]string, len(dc.CredHelpers))
+	for addr, helper := range dc.CredHelpers {
+		addr = normalizeHost(addr)
+		if isDockerHub(addr) {
+			for _, alias := range dockerHubAliases {
+				helpers[alias] = helper
 			}
 		}
+		helpers[addr] = helper
+	}
+	dc.CredHelpers = helpers
 
-		// special for docker.io
-		if addr == "index.docker.io" {
-			dc.Auths["docker.io"] = auth
+	return dc, nil
+}
+
+// authOf resolves the credential of the host, the credential helpers
+// (credHelpers, then credsStore) take precedence over the inline auths
+func (dc dockerConfig) authOf(host string) (AuthConfig, error) {
+	host = normalizeHost(host)
+
+	var helperErr error
+	helper := credHelper(dc.CredsStore)
+	if h, exist := dc.CredHelpers[host]; exist {
+		helper = credHelper(h)
+	}
+	if helper != "" {
+		auth, err := helper.get(helperServer(host))
+		if err == nil {
+			return auth, nil
+		}
+		if err != errCredNotFound {
+			helperErr = err
 		}
+	}
 
-		dc.Auths[addr] = auth
+	auth, exist := dc.Auths[host]
+	if !exist {
+		return AuthConfig{}, helperErr
 	}
+	username, password := UnmarshalAuth(auth.Auth)
+	return AuthConfig{
+		Username:      username,
+		Password:      password,
+		IdentityToken: auth.IdentityToken,
+	}, nil
+}
 
-	return dc, nil
+// hosts returns all the registries known by the config file, including
+// the ones stored in the credsStore
+func (dc dockerConfig) hosts() []string {
+	hosts := make([]string, 0, len(dc.Auths)+len(dc.CredHelpers))
+	for addr := range dc.Auths {
+		hosts = append(hosts, addr)
+	}
+	for addr := range dc.CredHelpers {
+		hosts = append(hosts, addr)
+	}
+	if dc.CredsStore != "" {
+		// the credentials of the store are skipped if it fails
+		servers, _ := credHelper(dc.CredsStore).list()
+		for server := range servers {
+			hosts = append(hosts, normalizeHost(server))
+		}
+	}
+	return hosts
+}
+
+// normalizeHost removes the scheme and the path of the registry address
+func normalizeHost(addr string) string {
+	if !strings.Contains(addr, "://") {
+		addr = "//" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" {
+		return strings.TrimPrefix(addr, "//")
+	}
+	return u.Host
+}
+
+func isDockerHub(host string) bool {
+	for _, alias := range dockerHubAliases {
+		if host == alias {
+			return true
+		}
+	}
+	return false
 }
 
 // UnmarshalAuth returns the username and password for that auth credential
@@ -67,7 +145,7 @@ func UnmarshalAuth(auth string) (string, string) {
 		return "", ""
 	}
 	str := fmt.Sprintf("%s", bs)
-	uAp := strings.Split(str, ":")
+	uAp := strings.SplitN(str, ":", 2)
 	if len(uAp) != 2 {
 		return "", ""
 	}
@@ -75,50 +153,66 @@ func UnmarshalAuth(auth string) (string, string) {
 	return uAp[0], uAp[1]
 }
 
-// a="1",b="2" -> map["a":"1","b":"2"]
-func string2Map(str string) map[string]string {
-	pairs := strings.Split(str, ",")
-	maps := make(map[string]string, 0)
-	for _, pair := range pairs {
-		p := strings.Split(pair, "=")
-		if len(p) != 2 {
-			continue
-		}
-		k := p[0]
-		v := strings.Replace(p[1], "\"", "", -1)
-		maps[k] = v
-	}
-
-	return maps
-}
-
 // GetAuthFromFile returns the username, password of that registry from
-// the config file ($HOME/.docker/config.json)
+// the config file ($HOME/.docker/config.json), the credential helpers
+// configured in it are honoured
 func GetAuthFromFile(registry string) (string, string) {
-	tokens, err := GetAuthTokens()
+	auth, err := GetAuthConfig(registry)
 	if err != nil {
 		return "", ""
 	}
-	return UnmarshalAuth(tokens[registry])
+	return auth.Username, auth.Password
 }
 
-// GetAuthTokens from $HOME/.docker/config.json
-func GetAuthTokens() (map[string]string, error) {
+// GetAuthConfig resolves the credential of that registry from
+// $HOME/.docker/config.json, it asks the `credHelpers` and `credsStore`
+// first and falls back to the inline `auths`
+func GetAuthConfig(registry string) (AuthConfig, error) {
+	cfg, err := parseDockerConfig()
+	if err != nil {
+		return AuthConfig{}, err
+	}
+	return cfg.authOf(registry)
+}
+
+// GetAuthConfigs resolves the credentials of all the registries
+// known by $HOME/.docker/config.json
+func GetAuthConfigs() (map[string]AuthConfig, error) {
 	cfg, err := parseDockerConfig()
 	if err != nil {
 		return nil, err
 	}
-	m := make(map[string]string)
-	for addr, auth := range cfg.Auths {
-		m[addr] = auth.Auth
+	m := make(map[string]AuthConfig)
+	for _, addr := range cfg.hosts() {
+		if _, done := m[addr]; done {
+			continue
+		}
+		// skip the registries which fail to resolve
+		auth, err := cfg.authOf(addr)
+		if err != nil {
+			continue
+		}
+		m[addr] = auth
 	}
 	return m, nil
 }
 
-func slice2Chan(slice []string, ch chan string) {
-	for _, s := range slice {
-		ch <- s
+// GetAuthTokens from $HOME/.docker/config.json, returns the base64 encoded
+// "username:password" of the registries, the registries authenticated by an
+// identity token are omitted
+func GetAuthTokens() (map[string]string, error) {
+	auths, err := GetAuthConfigs()
+	if err != nil {
+		return nil, err
 	}
+	m := make(map[string]string)
+	for addr, auth := range auths {
+		if auth.Username == "" && auth.Password == "" {
+			continue
+		}
+		m[addr] = auth.auth()
+	}
+	return m, nil
 }
 
 func chan2Slice(ch chan string, slice []string, start, end int) {
@@ -153,12 +247,3 @@ func ExtractTagNames(tags []Tag) []string {
 	}
 	return names
 }
-
-// DEBUG enables debug output
-var DEBUG bool
-
-func debug(format string, v ...interface{}) {
-	if DEBUG {
-		log.Printf(format, v...)
-	}
-}